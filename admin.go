@@ -0,0 +1,280 @@
+// Copyright (c) 2015-2017. Oleg Sklyar & teris.io. All rights reserved.
+// See the LICENSE file in the project root for licensing information.
+
+package longpoll
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// Access defines the level of access to the admin endpoints granted to a request.
+type Access int
+
+const (
+	// AccessNone denies any access.
+	AccessNone Access = iota
+	// AccessRead permits listing and inspecting subscriptions and topics.
+	AccessRead
+	// AccessWrite additionally permits dropping subscriptions, purging queues and publishing.
+	AccessWrite
+)
+
+// AdminHandler serves live management of the subscriptions of a LongPoll over HTTP with JSON
+// encoded responses. The handler can be mounted under any prefix and dispatches on the trailing
+// elements of the request path:
+//
+//	GET    {prefix}/subscriptions[?topic=A][&owner=o][&selector=expr][&offset=n][&limit=n]
+//	                                          -> {"subscriptions": [...], "total": n}
+//	DELETE {prefix}/subscriptions?selector=expr|topic=A
+//	                                          -> {"ids": [...]}, drops the matching subscriptions
+//	GET    {prefix}/subscriptions/{id}        -> subscription details with the "queue"
+//	DELETE {prefix}/subscriptions/{id}        -> 204, drops the subscription
+//	POST   {prefix}/subscriptions/{id}/purge  -> {"purged": n}
+//	POST   {prefix}/purge[?selector=expr]     -> {"ids": [...]}, purges the matching queues
+//	GET    {prefix}/topics                    -> {"topics": [...]}
+//	POST   {prefix}/publish?topic=A[&topic=B] -> {"accepted": n}, publishes the JSON request body
+//
+// Every request is subject to the authorize function: requests with AccessNone are rejected
+// with 401 Unauthorized, modifying requests with AccessRead with 403 Forbidden. Errors are
+// reported in the same manner as by Handler.
+type AdminHandler struct {
+	lp        *LongPoll
+	authorize func(r *http.Request) Access
+}
+
+// NewAdminHandler creates an HTTP handler for managing the subscriptions of the given LongPoll.
+// The authorize function determines the access level of every request; all requests are denied
+// if it is nil.
+func NewAdminHandler(lp *LongPoll, authorize func(r *http.Request) Access) *AdminHandler {
+	return &AdminHandler{lp: lp, authorize: authorize}
+}
+
+type listResponse struct {
+	Subscriptions []ChannelInfo `json:"subscriptions"`
+	Total         int           `json:"total"`
+}
+
+type detailsResponse struct {
+	ChannelInfo
+	Queue []*Message `json:"queue"`
+}
+
+type topicsResponse struct {
+	Topics []string `json:"topics"`
+}
+
+type purgeResponse struct {
+	Purged int `json:"purged"`
+}
+
+type bulkResponse struct {
+	IDs []string `json:"ids"`
+}
+
+type publishResponse struct {
+	Accepted int `json:"accepted"`
+}
+
+func (h *AdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	access := AccessNone
+	if h.authorize != nil {
+		access = h.authorize(r)
+	}
+	if access == AccessNone {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead && access < AccessWrite {
+		writeError(w, http.StatusForbidden, "read-only access")
+		return
+	}
+
+	elems := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	at := func(i int) string {
+		// i-th element from the end
+		if i < len(elems) {
+			return elems[len(elems)-1-i]
+		}
+		return ""
+	}
+	switch {
+	case at(0) == "subscriptions":
+		switch r.Method {
+		case http.MethodGet:
+			h.list(w, r)
+		case http.MethodDelete:
+			h.dropWhere(w, r)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	case at(1) == "subscriptions":
+		switch r.Method {
+		case http.MethodGet:
+			h.details(w, at(0))
+		case http.MethodDelete:
+			h.drop(w, at(0))
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	case at(2) == "subscriptions" && at(0) == "purge":
+		h.allow(w, r, http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+			h.purge(w, at(1))
+		})
+	case at(0) == "purge":
+		h.allow(w, r, http.MethodPost, h.purgeQueues)
+	case at(0) == "topics":
+		h.allow(w, r, http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+			write(w, http.StatusOK, topicsResponse{Topics: h.lp.Topics()})
+		})
+	case at(0) == "publish":
+		h.allow(w, r, http.MethodPost, h.publish)
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (h *AdminHandler) allow(w http.ResponseWriter, r *http.Request, method string, f http.HandlerFunc) {
+	if r.Method != method {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	f(w, r)
+}
+
+func (h *AdminHandler) list(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	offset, err := intParam(query.Get("offset"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit, err := intParam(query.Get("limit"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	selector, err := selectorParam(query.Get("selector"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	topic, owner := query.Get("topic"), query.Get("owner")
+	infos, total := h.lp.List(func(info ChannelInfo) bool {
+		if owner != "" && info.Owner != owner {
+			return false
+		}
+		if selector != nil && !selector(info.Labels) {
+			return false
+		}
+		if topic == "" {
+			return true
+		}
+		for _, t := range info.Topics {
+			if t == topic {
+				return true
+			}
+		}
+		return false
+	}, offset, limit)
+	if infos == nil {
+		infos = []ChannelInfo{}
+	}
+	write(w, http.StatusOK, listResponse{Subscriptions: infos, Total: total})
+}
+
+func (h *AdminHandler) details(w http.ResponseWriter, id string) {
+	ch, ok := h.lp.Channel(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, "no such subscription")
+		return
+	}
+	write(w, http.StatusOK, detailsResponse{ChannelInfo: ch.Info(), Queue: ch.Queue()})
+}
+
+func (h *AdminHandler) drop(w http.ResponseWriter, id string) {
+	if _, ok := h.lp.Channel(id); !ok {
+		writeError(w, http.StatusNotFound, "no such subscription")
+		return
+	}
+	h.lp.Drop(id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AdminHandler) purge(w http.ResponseWriter, id string) {
+	ch, ok := h.lp.Channel(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, "no such subscription")
+		return
+	}
+	write(w, http.StatusOK, purgeResponse{Purged: ch.Purge()})
+}
+
+func (h *AdminHandler) dropWhere(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	selector, err := selectorParam(query.Get("selector"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var ids []string
+	switch topic := query.Get("topic"); {
+	case selector != nil && topic != "":
+		writeError(w, http.StatusBadRequest, "either selector or topic expected")
+		return
+	case selector != nil:
+		ids = h.lp.DropWhere(selector)
+	case topic != "":
+		ids = h.lp.DropTopic(topic)
+	default:
+		// guard against dropping everything by accident
+		writeError(w, http.StatusBadRequest, "selector or topic expected")
+		return
+	}
+	write(w, http.StatusOK, bulkResponse{IDs: nonNil(ids)})
+}
+
+func (h *AdminHandler) purgeQueues(w http.ResponseWriter, r *http.Request) {
+	selector, err := selectorParam(r.URL.Query().Get("selector"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	write(w, http.StatusOK, bulkResponse{IDs: nonNil(h.lp.PurgeQueues(selector))})
+}
+
+func selectorParam(value string) (Selector, error) {
+	if value == "" {
+		return nil, nil
+	}
+	return ParseSelector(value)
+}
+
+func nonNil(ids []string) []string {
+	if ids == nil {
+		return []string{}
+	}
+	return ids
+}
+
+func (h *AdminHandler) publish(w http.ResponseWriter, r *http.Request) {
+	var data interface{}
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+	n, err := h.lp.PublishSync(data, r.URL.Query()["topic"]...)
+	if _, ok := err.(*PublishError); err != nil && !ok {
+		if lerr, ok := err.(*RateLimitError); ok {
+			writeLimited(w, lerr)
+		} else if !h.lp.isAccepting() {
+			writeError(w, http.StatusServiceUnavailable, err.Error())
+		} else {
+			writeError(w, http.StatusBadRequest, err.Error())
+		}
+		return
+	}
+	// channels closed concurrently are of no concern here
+	write(w, http.StatusOK, publishResponse{Accepted: n})
+}
@@ -0,0 +1,159 @@
+// Copyright (c) 2015-2017. Oleg Sklyar & teris.io. All rights reserved.
+// See the LICENSE file in the project root for licensing information.
+
+package longpoll_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/teris-io/longpoll"
+)
+
+func newAdmin(ps *longpoll.LongPoll) http.Handler {
+	return longpoll.NewAdminHandler(ps, func(r *http.Request) longpoll.Access {
+		switch r.Header.Get("Authorization") {
+		case "rw":
+			return longpoll.AccessWrite
+		case "ro":
+			return longpoll.AccessRead
+		default:
+			return longpoll.AccessNone
+		}
+	})
+}
+
+func serveAdmin(h http.Handler, auth, method, uri, body string, res interface{}) int {
+	req := httptest.NewRequest(method, uri, strings.NewReader(body))
+	req.Header.Set("Authorization", auth)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if res != nil {
+		json.NewDecoder(rec.Body).Decode(res)
+	}
+	return rec.Code
+}
+
+func TestAdminHandler_onListAndDetails_success(t *testing.T) {
+	ps := longpoll.New()
+	defer ps.Close()
+	h := newAdmin(ps)
+	id1, _ := ps.SubscribeWith(time.Minute, longpoll.SubscribeOptions{Owner: "alice"}, "A")
+	time.Sleep(time.Millisecond)
+	id2, _ := ps.SubscribeWith(time.Minute, longpoll.SubscribeOptions{Owner: "bob"}, "A", "B")
+	ps.PublishSync("a", "A")
+
+	var list struct {
+		Subscriptions []longpoll.ChannelInfo
+		Total         int
+	}
+	if code := serveAdmin(h, "ro", http.MethodGet, "/admin/subscriptions?topic=B", "", &list); code != http.StatusOK {
+		t.Fatalf("unexpected status %v", code)
+	}
+	if list.Total != 1 || len(list.Subscriptions) != 1 || list.Subscriptions[0].ID != id2 || list.Subscriptions[0].Owner != "bob" {
+		t.Errorf("unexpected list %v", list)
+	}
+	serveAdmin(h, "ro", http.MethodGet, "/admin/subscriptions?limit=1", "", &list)
+	if list.Total != 2 || len(list.Subscriptions) != 1 || list.Subscriptions[0].ID != id1 {
+		t.Errorf("unexpected page %v", list)
+	}
+
+	var details struct {
+		ID        string
+		QueueSize int
+		Queue     []longpoll.Message
+	}
+	if code := serveAdmin(h, "ro", http.MethodGet, "/admin/subscriptions/"+id1, "", &details); code != http.StatusOK {
+		t.Fatalf("unexpected status %v", code)
+	}
+	if details.ID != id1 || details.QueueSize != 1 || len(details.Queue) != 1 || details.Queue[0].Data != "a" {
+		t.Errorf("unexpected details %v", details)
+	}
+
+	var topics struct{ Topics []string }
+	serveAdmin(h, "ro", http.MethodGet, "/admin/topics", "", &topics)
+	if len(topics.Topics) != 2 || topics.Topics[0] != "A" {
+		t.Errorf("unexpected topics %v", topics)
+	}
+}
+
+func TestAdminHandler_onWriteOperations_success(t *testing.T) {
+	ps := longpoll.New()
+	defer ps.Close()
+	h := newAdmin(ps)
+	id1 := ps.MustSubscribe(time.Minute, "A")
+	id2 := ps.MustSubscribe(time.Minute, "A")
+
+	var pub struct{ Accepted int }
+	if code := serveAdmin(h, "rw", http.MethodPost, "/admin/publish?topic=A", `{"test": true}`, &pub); code != http.StatusOK || pub.Accepted != 2 {
+		t.Errorf("unexpected publish result %v, %v", code, pub)
+	}
+	var purge struct{ Purged int }
+	if code := serveAdmin(h, "rw", http.MethodPost, "/admin/subscriptions/"+id1+"/purge", "", &purge); code != http.StatusOK || purge.Purged != 1 {
+		t.Errorf("unexpected purge result %v, %v", code, purge)
+	}
+	if ch, _ := ps.Channel(id1); ch.QueueSize() != 0 || ch.Stats().Dropped != 1 {
+		t.Error("expected queue purged")
+	}
+	if code := serveAdmin(h, "rw", http.MethodDelete, "/admin/subscriptions/"+id2, "", nil); code != http.StatusNoContent {
+		t.Errorf("unexpected status %v", code)
+	}
+	if _, ok := ps.Channel(id2); ok {
+		t.Error("expected subscription dropped")
+	}
+	if code := serveAdmin(h, "rw", http.MethodDelete, "/admin/subscriptions/"+id2, "", nil); code != http.StatusNotFound {
+		t.Errorf("expected not found, found %v", code)
+	}
+}
+
+func TestAdminHandler_onAccess_enforced(t *testing.T) {
+	ps := longpoll.New()
+	defer ps.Close()
+	h := newAdmin(ps)
+	id := ps.MustSubscribe(time.Minute, "A")
+
+	if code := serveAdmin(h, "", http.MethodGet, "/subscriptions", "", nil); code != http.StatusUnauthorized {
+		t.Errorf("expected unauthorized, found %v", code)
+	}
+	if code := serveAdmin(h, "ro", http.MethodDelete, "/subscriptions/"+id, "", nil); code != http.StatusForbidden {
+		t.Errorf("expected forbidden, found %v", code)
+	}
+	if code := serveAdmin(h, "ro", http.MethodPost, "/publish?topic=A", "1", nil); code != http.StatusForbidden {
+		t.Errorf("expected forbidden, found %v", code)
+	}
+	if _, ok := ps.Channel(id); !ok {
+		t.Error("expected subscription intact")
+	}
+	if code := serveAdmin(longpoll.NewAdminHandler(ps, nil), "rw", http.MethodGet, "/topics", "", nil); code != http.StatusUnauthorized {
+		t.Errorf("expected denied without authorize, found %v", code)
+	}
+}
+
+func TestAdminHandler_onInvalidRequests_errors(t *testing.T) {
+	ps := longpoll.New()
+	defer ps.Close()
+	h := newAdmin(ps)
+
+	for uri, expected := range map[string]int{
+		"GET /subscriptions?limit=x":         http.StatusBadRequest,
+		"GET /subscriptions/whatever":        http.StatusNotFound,
+		"POST /subscriptions/whatever/purge": http.StatusNotFound,
+		"POST /publish?topic=A":              http.StatusBadRequest,
+		"POST /publish":                      http.StatusBadRequest,
+		"POST /topics":                       http.StatusMethodNotAllowed,
+		"GET /whatever":                      http.StatusNotFound,
+	} {
+		parts := strings.SplitN(uri, " ", 2)
+		body := ""
+		if parts[1] == "/publish" {
+			body = "1"
+		}
+		if code := serveAdmin(h, "rw", parts[0], parts[1], body, nil); code != expected {
+			t.Errorf("expected %v for %v, found %v", expected, uri, code)
+		}
+	}
+}
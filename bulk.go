@@ -0,0 +1,115 @@
+// Copyright (c) 2015-2017. Oleg Sklyar & teris.io. All rights reserved.
+// See the LICENSE file in the project root for licensing information.
+
+package longpoll
+
+import (
+	"errors"
+	"sort"
+)
+
+// DropWhere drops all subscription channels with labels accepted by the selector, all of them if
+// the selector is nil, and returns their sorted Ids. Bulk operations are atomic with respect to
+// concurrent subscribing and publishing: these take place either before or after the whole
+// operation.
+func (lp *LongPoll) DropWhere(selector Selector) []string {
+	return lp.dropWhere(func(ch *Channel) bool {
+		return selector == nil || selector(ch.labels())
+	})
+}
+
+// DropTopic drops all subscription channels subscribed to the topic, e.g. of a revoked document,
+// and returns their sorted Ids. Retained values and the history of the topic are kept, see
+// ClearRetained. The operation is atomic, see DropWhere.
+func (lp *LongPoll) DropTopic(topic string) []string {
+	return lp.dropWhere(func(ch *Channel) bool {
+		// no locking: read-only upon construction
+		return ch.topics[topic]
+	})
+}
+
+func (lp *LongPoll) dropWhere(match func(ch *Channel) bool) []string {
+	lp.bulk.Lock()
+	defer lp.bulk.Unlock()
+	var chs []*Channel
+	for _, ch := range lp.Channels() {
+		if ch.IsAlive() && match(ch) {
+			ch.Drop()
+			chs = append(chs, ch)
+		}
+	}
+	res := make([]string, len(chs))
+	for i, ch := range chs {
+		// remove right away rather than once the channel has exited, see Drop, but only after the
+		// queue has been counted as dropped by ch.Drop for the stats to account for it
+		lp.drop(ch.id)
+		res[i] = ch.id
+	}
+	sort.Strings(res)
+	return res
+}
+
+// PurgeQueues discards the queued messages of all subscription channels with labels accepted by
+// the selector, all of them if the selector is nil, and returns the sorted Ids of those that had
+// messages queued. The operation is atomic, see DropWhere.
+func (lp *LongPoll) PurgeQueues(selector Selector) []string {
+	lp.bulk.Lock()
+	defer lp.bulk.Unlock()
+	var res []string
+	for _, ch := range lp.Channels() {
+		if ch.IsAlive() && (selector == nil || selector(ch.labels())) && ch.Purge() > 0 {
+			res = append(res, ch.id)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// PublishTo publishes data synchronously, see PublishSync, to the subscription channels of the
+// given Ids only, skipping unknown ones, and returns the sorted Ids of those that accepted the data
+// on at least one of the topics. Targeted data is neither retained nor recorded in the history.
+// Subscription channels that fail to accept the data are reported in a *PublishError.
+func (lp *LongPoll) PublishTo(ids []string, data interface{}, topics ...string) ([]string, error) {
+	if !lp.isAccepting() {
+		return nil, errors.New("pubsub is down")
+	}
+	if len(topics) == 0 {
+		return nil, errors.New("expected at least one topic")
+	}
+	if err := lp.allowPublish(topics); err != nil {
+		return nil, err
+	}
+	lp.bulk.RLock()
+	defer lp.bulk.RUnlock()
+	msgs := make([]*Message, len(topics))
+	for i, topic := range topics {
+		msgs[i] = newMessage(data, topic)
+	}
+	var res []string
+	var perr *PublishError
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		ch, ok := lp.Channel(id)
+		if !ok || seen[id] {
+			continue
+		}
+		seen[id] = true
+		accepted := false
+		for _, msg := range msgs {
+			ok, err := ch.publish(msg)
+			if err != nil {
+				perr = perr.add(id, err)
+				break
+			}
+			accepted = accepted || ok
+		}
+		if accepted {
+			res = append(res, id)
+		}
+	}
+	sort.Strings(res)
+	if perr != nil {
+		return res, perr
+	}
+	return res, nil
+}
@@ -0,0 +1,197 @@
+// Copyright (c) 2015-2017. Oleg Sklyar & teris.io. All rights reserved.
+// See the LICENSE file in the project root for licensing information.
+
+package longpoll_test
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/teris-io/longpoll"
+)
+
+func TestLongPoll_onDropTopic_dropsSubscribers(t *testing.T) {
+	ps := longpoll.New()
+	defer ps.Close()
+	id1 := ps.MustSubscribe(time.Minute, "doc1")
+	id2 := ps.MustSubscribe(time.Minute, "doc1", "doc2")
+	id3 := ps.MustSubscribe(time.Minute, "doc2")
+
+	dropped := ps.DropTopic("doc1")
+	expected := []string{id1, id2}
+	sort.Strings(expected)
+	if len(dropped) != 2 || dropped[0] != expected[0] || dropped[1] != expected[1] {
+		t.Errorf("expected %v dropped, found %v", expected, dropped)
+	}
+	if ids := ps.Ids(); len(ids) != 1 || ids[0] != id3 {
+		t.Errorf("expected %v left, found %v", id3, ids)
+	}
+	if dropped = ps.DropTopic("doc1"); len(dropped) != 0 {
+		t.Errorf("expected nothing dropped, found %v", dropped)
+	}
+}
+
+func TestLongPoll_onDropWhere_queuesCountedAsDropped(t *testing.T) {
+	ps := longpoll.New()
+	defer ps.Close()
+	ps.SubscribeWith(time.Minute, longpoll.SubscribeOptions{Labels: map[string]string{"tenant": "acme"}}, "A")
+	ps.MustSubscribe(time.Minute, "doc1")
+	ps.MustSubscribe(time.Minute, "A")
+	ps.PublishSync("a", "A")
+	ps.PublishSync("d", "doc1")
+
+	ps.DropWhere(longpoll.MatchLabels(map[string]string{"tenant": "acme"}))
+	ps.DropTopic("doc1")
+	if dropped := ps.Stats().Dropped; dropped != 2 {
+		t.Errorf("expected 2 dropped messages, found %v", dropped)
+	}
+}
+
+func TestLongPoll_onPurgeQueues_purgesSelected(t *testing.T) {
+	ps := longpoll.New()
+	defer ps.Close()
+	acme, _ := ps.SubscribeWith(time.Minute, longpoll.SubscribeOptions{Labels: map[string]string{"tenant": "acme"}}, "A")
+	idle, _ := ps.SubscribeWith(time.Minute, longpoll.SubscribeOptions{Labels: map[string]string{"tenant": "acme"}}, "B")
+	other, _ := ps.SubscribeWith(time.Minute, longpoll.SubscribeOptions{Labels: map[string]string{"tenant": "other"}}, "A")
+	ps.PublishSync("a", "A")
+
+	purged := ps.PurgeQueues(longpoll.MatchLabels(map[string]string{"tenant": "acme"}))
+	if len(purged) != 1 || purged[0] != acme {
+		t.Errorf("expected %v purged, found %v", acme, purged)
+	}
+	for id, expected := range map[string]int{acme: 0, idle: 0, other: 1} {
+		if ch, _ := ps.Channel(id); ch.QueueSize() != expected {
+			t.Errorf("%s: expected %d queued, found %d", id, expected, ch.QueueSize())
+		}
+	}
+	if purged = ps.PurgeQueues(nil); len(purged) != 1 || purged[0] != other {
+		t.Errorf("expected %v purged, found %v", other, purged)
+	}
+}
+
+func TestLongPoll_onPurgeQueuesAfterPublish_purgesAll(t *testing.T) {
+	ps := longpoll.New()
+	defer ps.Close()
+	var ids []string
+	for i := 0; i < 100; i++ {
+		ids = append(ids, ps.MustSubscribe(time.Minute, "A"))
+	}
+	ps.Publish("a", "A")
+
+	if purged := ps.PurgeQueues(nil); len(purged) != len(ids) {
+		t.Errorf("expected all purged, found %d", len(purged))
+	}
+	time.Sleep(50 * time.Millisecond)
+	for _, id := range ids {
+		if ch, _ := ps.Channel(id); ch.QueueSize() != 0 {
+			t.Errorf("%s: expected nothing queued after purge, found %d", id, ch.QueueSize())
+		}
+	}
+}
+
+func TestLongPoll_onPublishTo_deliversToIds(t *testing.T) {
+	ps := longpoll.New()
+	defer ps.Close()
+	ps.SetHistory(10, 0)
+	id1 := ps.MustSubscribe(time.Minute, "A")
+	id2 := ps.MustSubscribe(time.Minute, "B")
+	id3 := ps.MustSubscribe(time.Minute, "A")
+
+	ids, err := ps.PublishTo([]string{id1, id2, id1, "unknown"}, "direct", "A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || ids[0] != id1 {
+		t.Errorf("expected %v, found %v", id1, ids)
+	}
+	for id, expected := range map[string]int{id1: 1, id2: 0, id3: 0} {
+		if ch, _ := ps.Channel(id); ch.QueueSize() != expected {
+			t.Errorf("%s: expected %d queued, found %d", id, expected, ch.QueueSize())
+		}
+	}
+	if hist := ps.History("A"); len(hist) != 0 {
+		t.Errorf("expected no history, found %v", hist)
+	}
+	if _, err := ps.PublishTo([]string{id1}, "direct"); err == nil {
+		t.Error("expected error without topics")
+	}
+}
+
+func TestLongPoll_onBulkConcurrently_consistent(t *testing.T) {
+	ps := longpoll.New()
+	defer ps.Close()
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				ps.MustSubscribe(time.Minute, "doc")
+				ps.PublishSync("x", "doc")
+			}
+		}()
+	}
+	for i := 0; i < 50; i++ {
+		ps.PurgeQueues(nil)
+		for _, id := range ps.DropTopic("doc") {
+			if _, ok := ps.Channel(id); ok {
+				t.Fatalf("expected %s dropped", id)
+			}
+		}
+	}
+	close(stop)
+	wg.Wait()
+	ps.DropTopic("doc")
+	if ids := ps.Ids(); len(ids) != 0 {
+		t.Errorf("expected all dropped, found %d", len(ids))
+	}
+}
+
+func TestAdminHandler_onBulkOperations_success(t *testing.T) {
+	ps := longpoll.New()
+	defer ps.Close()
+	h := newAdmin(ps)
+	acme, _ := ps.SubscribeWith(time.Minute, longpoll.SubscribeOptions{Labels: map[string]string{"tenant": "acme"}}, "A")
+	other, _ := ps.SubscribeWith(time.Minute, longpoll.SubscribeOptions{Labels: map[string]string{"tenant": "other"}}, "B")
+	ps.PublishSync("a", "A")
+
+	var res struct{ IDs []string }
+	if code := serveAdmin(h, "rw", http.MethodPost, "/admin/purge?selector=tenant%3Dacme", "", &res); code != http.StatusOK {
+		t.Fatalf("unexpected status %v", code)
+	}
+	if len(res.IDs) != 1 || res.IDs[0] != acme {
+		t.Errorf("unexpected purged %v", res.IDs)
+	}
+	if code := serveAdmin(h, "rw", http.MethodDelete, "/admin/subscriptions?topic=B", "", &res); code != http.StatusOK {
+		t.Fatalf("unexpected status %v", code)
+	}
+	if len(res.IDs) != 1 || res.IDs[0] != other {
+		t.Errorf("unexpected dropped %v", res.IDs)
+	}
+	serveAdmin(h, "rw", http.MethodDelete, "/admin/subscriptions?selector=tenant", "", &res)
+	if len(res.IDs) != 1 || res.IDs[0] != acme || len(ps.Ids()) != 0 {
+		t.Errorf("unexpected dropped %v", res.IDs)
+	}
+
+	for uri, expected := range map[string]int{
+		"/admin/subscriptions":                    http.StatusBadRequest,
+		"/admin/subscriptions?topic=A&selector=x": http.StatusBadRequest,
+		"/admin/subscriptions?selector=%3D":       http.StatusBadRequest,
+	} {
+		if code := serveAdmin(h, "rw", http.MethodDelete, uri, "", nil); code != expected {
+			t.Errorf("%s: expected %d, found %d", uri, expected, code)
+		}
+	}
+	if code := serveAdmin(h, "ro", http.MethodPost, "/admin/purge", "", nil); code != http.StatusForbidden {
+		t.Errorf("expected forbidden, found %d", code)
+	}
+}
@@ -4,8 +4,10 @@
 package longpoll
 
 import (
+	"context"
 	"errors"
 	"runtime"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -25,17 +27,49 @@ type Channel struct {
 	id      string
 	onClose func(id string)
 	topics  map[string]bool
-	data    []interface{}
+	owner   atomic.Value
+	tags    atomic.Value
+	created time.Time
+	lastget int64
+	data    []*Message
+	ttl     time.Duration
+	filter  Filter
+	reshape Transform
+	sent    uint64
+	skipped uint64
+	expired uint64
+	merged  uint64
+	dropped uint64
 	alive   int32
-	notif   *getnotifier
+	away    int32
+	lapsed  int32 // dropped by the timeout rather than explicitly
+	wg      sync.WaitGroup
+	mode    GetMode
+	waiting []*getnotifier
 	tor     *Timeout
 }
 
 type getnotifier struct {
 	ping   chan bool
 	pinged bool
+	// batch delivered by another Get in the GetBroadcast mode
+	batch *Batch
 }
 
+// GetMode defines how data is distributed across concurrent Get requests to the same channel.
+type GetMode int
+
+const (
+	// GetKick lets every new Get request trigger an immediate return of the waiting one, so that
+	// data is received by the latest request. This is the default.
+	GetKick GetMode = iota
+	// GetQueue keeps concurrent Get requests waiting in the order of arrival and delivers data to
+	// the one waiting longest.
+	GetQueue
+	// GetBroadcast delivers every batch of data to all of the currently waiting Get requests.
+	GetBroadcast
+)
+
 // NewChannel constructs a new long-polling pubsub channel with the given timeout, optional exit
 // handler, and subscribing to given topics. Every new channel gets a unique channel/subscription Id
 // assigned based on UUID.v4.
@@ -54,12 +88,13 @@ func NewChannel(timeout time.Duration, onClose func(id string), topics ...string
 		id:      id,
 		onClose: onClose,
 		topics:  make(map[string]bool),
+		created: time.Now(),
 		alive:   yes,
 	}
 	for _, topic := range topics {
 		ch.topics[topic] = true
 	}
-	if tor, err := NewTimeout(timeout, ch.Drop); err == nil {
+	if tor, err := NewTimeout(timeout, ch.expire); err == nil {
 		ch.tor = tor
 	} else {
 		return nil, err
@@ -78,35 +113,158 @@ func MustNewChannel(timeout time.Duration, onClose func(id string), topics ...st
 }
 
 // Publish publishes data on the channel in a non-blocking manner if the topic corresponds to one of
-// those provided at construction. Data published to other topics will be silently ignored. No topic
-// information is persisted and retrieved with the data.
+// those provided at construction. Data published to other topics will be silently ignored. The topic
+// is only retrieved with the data via GetMessages.
+//
+// The data is queued asynchronously, therefore, no ordering is guaranteed between consecutive calls
+// and a successful return does not mean the data has been queued. Use PublishSync for that.
 func (ch *Channel) Publish(data interface{}, topic string) error {
+	return ch.publishAsync(newMessage(data, topic))
+}
+
+func (ch *Channel) publishAsync(msg *Message) error {
 	if !ch.IsAlive() {
 		return errors.New("subscription channel is down")
 	}
-	// no locking: read-only upon construction
-	if _, ok := ch.topics[topic]; !ok {
+	if !ch.accepts(msg) {
 		return nil
 	}
-	go func() {
+	spawned := ch.spawn(func() {
 		ch.mx.Lock()
 		defer ch.mx.Unlock()
 
 		// ch could have died between the check above and entering the lock
 		if ch.IsAlive() {
-			ch.data = append(ch.data, data)
-			if ch.notif != nil && !ch.notif.pinged {
-				ch.notif.pinged = true
-				ch.notif.ping <- true
-			}
+			ch.enqueue(msg)
 		}
-	}()
+	})
+	if !spawned {
+		return errors.New("subscription channel is down")
+	}
 	// this routine is likely to be run within a goroutine and in case of non-stop publishing Gets may
 	// have little chance to receive data otherwise
 	defer runtime.Gosched()
 	return nil
 }
 
+// PublishSync publishes data on the channel synchronously if the topic corresponds to one of those
+// provided at construction. Upon return the data is either queued or handed over to the waiting
+// Get request, thus data published by the same publisher is received in the order of publishing.
+// The function reports whether the data has been accepted, that is if the topic matched.
+func (ch *Channel) PublishSync(data interface{}, topic string) (bool, error) {
+	return ch.publish(newMessage(data, topic))
+}
+
+// PublishWith acts just like PublishSync, but accepts further message options.
+func (ch *Channel) PublishWith(data interface{}, topic string, opts PublishOptions) (bool, error) {
+	return ch.publish(newMessageWith(data, topic, opts))
+}
+
+func (ch *Channel) publish(msg *Message) (bool, error) {
+	if !ch.IsAlive() {
+		return false, errors.New("subscription channel is down")
+	}
+	if !ch.accepts(msg) {
+		return false, nil
+	}
+	ch.mx.Lock()
+	defer ch.mx.Unlock()
+
+	// ch could have died between the check above and entering the lock
+	if !ch.IsAlive() {
+		return false, errors.New("subscription channel is down")
+	}
+	return ch.enqueue(msg), nil
+}
+
+// accepts tests if the message is published to a topic of the channel and, if targeted, selects
+// the channel.
+func (ch *Channel) accepts(msg *Message) bool {
+	// no locking: read-only upon construction
+	if _, ok := ch.topics[msg.Topic]; !ok {
+		return false
+	}
+	return msg.selector == nil || msg.selector(ch.labels())
+}
+
+// enqueue inserts a message into the queue by priority and notifies the waiting Get if any, unless
+// the message is rejected by the filter. Must be called under lock.
+func (ch *Channel) enqueue(msg *Message) bool {
+	if ch.filter != nil && !ch.filter(msg) {
+		atomic.AddUint64(&ch.skipped, 1)
+		return false
+	}
+	if ch.reshape != nil {
+		msg = msg.transformed(ch.reshape(msg))
+	}
+	if !ch.conflate(msg) {
+		ch.insert(msg)
+	}
+	ch.notify()
+	return true
+}
+
+// notify pings the waiting Get requests that should receive data: all of them in the GetBroadcast
+// mode, otherwise the one waiting longest unless already pinged. Must be called under lock.
+func (ch *Channel) notify() {
+	for _, notif := range ch.waiting {
+		notif.notify()
+		if ch.mode != GetBroadcast {
+			return
+		}
+	}
+}
+
+func (notif *getnotifier) notify() {
+	if !notif.pinged {
+		notif.pinged = true
+		notif.ping <- true
+	}
+}
+
+// unwait removes the Get from the waiting list, reporting if it was still there. Must be called
+// under lock.
+func (ch *Channel) unwait(notif *getnotifier) bool {
+	for i, waiting := range ch.waiting {
+		if waiting == notif {
+			ch.waiting = append(ch.waiting[:i:i], ch.waiting[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// insert places the message after all queued messages of the same or higher priority.
+func (ch *Channel) insert(msg *Message) {
+	i := len(ch.data)
+	for i > 0 && ch.data[i-1].priority < msg.priority {
+		i--
+	}
+	ch.data = append(ch.data, nil)
+	copy(ch.data[i+1:], ch.data[i:])
+	ch.data[i] = msg
+}
+
+// conflate replaces a queued message with the same key and topic, reporting if it did so. The
+// replacement keeps the position in the queue unless its priority differs.
+func (ch *Channel) conflate(msg *Message) bool {
+	if msg.key == "" {
+		return false
+	}
+	for i := len(ch.data) - 1; i >= 0; i-- {
+		if queued := ch.data[i]; queued.key == msg.key && queued.Topic == msg.Topic {
+			atomic.AddUint64(&ch.merged, 1)
+			if queued.priority == msg.priority {
+				ch.data[i] = msg
+				return true
+			}
+			ch.data = append(ch.data[:i], ch.data[i+1:]...)
+			return false
+		}
+	}
+	return false
+}
+
 // Get requests data published on all of the channel topics. The function returns a channel
 // to receive the data set on.
 //
@@ -118,109 +276,332 @@ func (ch *Channel) Publish(data interface{}, topic string) error {
 //
 // Multiple Get requests to the channel can be made concurrently, however, every data sample
 // will be delivered to only one request issuer. It is not guaranteed to which one, although
-// every new incoming request will trigger a return of any earlier one.
+// every new incoming request will trigger a return of any earlier one. This is the default GetKick
+// mode, see SetGetMode for queueing or broadcasting to concurrent requests instead.
 func (ch *Channel) Get(polltime time.Duration) (chan []interface{}, error) {
+	batchch, err := ch.Poll(polltime, GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	resp := make(chan []interface{}, 1)
+	spawned := ch.spawn(func() {
+		resp <- payloads((<-batchch).Messages)
+	})
+	if !spawned {
+		return nil, errors.New("subscription channel is down")
+	}
+	return resp, nil
+}
+
+// GetMessages acts just like Get, however, delivers data in message envelopes carrying the topic,
+// the sequence number and the time of publishing. The sequence number of the last received message
+// can be used to resume a subscription, see (*LongPoll).SubscribeWith.
+func (ch *Channel) GetMessages(polltime time.Duration) (chan []*Message, error) {
+	batchch, err := ch.Poll(polltime, GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	resp := make(chan []*Message, 1)
+	spawned := ch.spawn(func() {
+		resp <- (<-batchch).Messages
+	})
+	if !spawned {
+		return nil, errors.New("subscription channel is down")
+	}
+	return resp, nil
+}
+
+// Poll acts just like GetMessages, but accepts limits on the size of the response. Messages beyond
+// the limits remain queued and the batch is flagged with More for the client to poll again
+// immediately. The batch delivered on the returned channel is never nil.
+func (ch *Channel) Poll(polltime time.Duration, opts GetOptions) (chan *Batch, error) {
+	return ch.PollContext(context.Background(), polltime, opts)
+}
+
+// PollContext acts just like Poll, but returns an empty batch as soon as the context is done,
+// e.g. when the client has gone away. The cancelled request stops waiting without taking any data
+// off the queue, which is left for the next request.
+func (ch *Channel) PollContext(ctx context.Context, polltime time.Duration, opts GetOptions) (chan *Batch, error) {
 	if !ch.IsAlive() {
 		return nil, errors.New("subscription channel is down")
 	}
 	if polltime <= 0 {
 		return nil, errors.New("positive polltime value expected")
 	}
-	resp := make(chan []interface{}, 1)
-	go func() {
+	resp := make(chan *Batch, 1)
+	atomic.StoreInt64(&ch.lastget, time.Now().UnixNano())
+	spawned := ch.spawn(func() {
 		ch.tor.Ping()
 		ch.mx.Lock()
 		// ch could have died between the check above and entering the lock
 		if !ch.IsAlive() {
 			// next request will result in an error
-			resp <- nil
+			resp <- ch.empty()
 			ch.mx.Unlock()
 			return
 		}
-		// notify existing Get to terminate immediately (will wait for lock)
-		if ch.notif != nil && !ch.notif.pinged {
-			ch.notif.pinged = true
-			ch.notif.ping <- true
+		if ch.mode == GetKick {
+			// notify existing Get to terminate immediately (will wait for lock)
+			for _, notif := range ch.waiting {
+				notif.notify()
+			}
+			ch.waiting = nil
 		}
 
-		// ch.notif is reset either here, ...
-		if ch.onDataWaiting(resp) {
+		if ch.onDataWaiting(resp, opts) {
+			ch.mx.Unlock()
+			return
+		}
+		if ch.isGoingAway() {
+			// no waiting for data, the client should reconnect elsewhere
+			resp <- ch.empty()
 			ch.mx.Unlock()
 			return
 		}
 
-		// ...or here. Set this one to be notified by Publish
+		// set this one to be notified by Publish
 		notif := &getnotifier{ping: make(chan bool, 1), pinged: false}
-		ch.notif = notif
+		ch.waiting = append(ch.waiting, notif)
 		ch.mx.Unlock()
 
-		gotdata := no
 		pollend := make(chan bool, 1)
-
-		go ch.startLongpollTimer(polltime, pollend, &gotdata)
+		stop := make(chan struct{})
+		// not started if dropped concurrently, in which case Drop notifies this Get
+		ch.spawn(func() {
+			ch.startLongpollTimer(polltime, pollend, stop)
+		})
 
 		select {
 		case <-notif.ping:
-			ch.onNewDataLocking(resp, notif)
+			if opts.Linger > 0 {
+				ch.linger(ctx, notif, opts)
+			}
+			if ctx.Err() != nil {
+				ch.onCancelLocking(resp, notif)
+			} else {
+				ch.onNewDataLocking(resp, notif, opts)
+			}
 		case <-pollend:
-			ch.onLongpollTimeoutLocking(resp, notif)
+			ch.onLongpollTimeoutLocking(resp, notif, opts)
+		case <-ctx.Done():
+			ch.onCancelLocking(resp, notif)
 		}
 
 		// signal the long-poll timer to stop
-		atomic.StoreInt32(&gotdata, yes)
-	}()
+		close(stop)
+	})
+	if !spawned {
+		return nil, errors.New("subscription channel is down")
+	}
 	return resp, nil
 }
 
-func (ch *Channel) startLongpollTimer(polltime time.Duration, pollend chan bool, gotdata *int32) {
-	hundredth := polltime / 100
-	endpoint := time.Now().Add(polltime)
-	for time.Now().Before(endpoint) {
-		// if Get has data, this timer is irrelevant
-		if atomic.LoadInt32(gotdata) == yes {
+// startLongpollTimer reports the end of the polltime on pollend unless stopped earlier, once the
+// Get is served otherwise.
+func (ch *Channel) startLongpollTimer(polltime time.Duration, pollend chan bool, stop chan struct{}) {
+	timer := time.NewTimer(polltime)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		pollend <- true
+	case <-stop:
+	}
+}
+
+// linger keeps the Get collecting data over the linger window after the first message has arrived,
+// unless the batch limits are reached or the Get is served or kicked out earlier.
+func (ch *Channel) linger(ctx context.Context, notif *getnotifier, opts GetOptions) {
+	deadline := time.NewTimer(opts.Linger)
+	defer deadline.Stop()
+	for {
+		ch.mx.Lock()
+		if !ch.isWaiting(notif) || !ch.IsAlive() || ch.isGoingAway() || ch.full(opts) {
+			ch.mx.Unlock()
 			return
 		}
-		// splitting polltime into 100 segments, let it quit much quicker
-		time.Sleep(hundredth)
+		// re-arm for the next Publish
+		ping := make(chan bool, 1)
+		notif.ping = ping
+		notif.pinged = false
+		ch.mx.Unlock()
+
+		select {
+		case <-ping:
+		case <-deadline.C:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (ch *Channel) isWaiting(notif *getnotifier) bool {
+	for _, waiting := range ch.waiting {
+		if waiting == notif {
+			return true
+		}
 	}
-	pollend <- true
+	return false
 }
 
-func (ch *Channel) onDataWaiting(resp chan []interface{}) bool {
+// full tests if the queue has reached the batch limits. Must be called under lock.
+func (ch *Channel) full(opts GetOptions) bool {
+	if opts.MaxMessages > 0 && len(ch.data) >= opts.MaxMessages {
+		return true
+	}
+	if opts.MaxBytes > 0 {
+		bytes := 0
+		for _, msg := range ch.data {
+			if bytes += msg.size(); bytes >= opts.MaxBytes {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (ch *Channel) onDataWaiting(resp chan *Batch, opts GetOptions) bool {
+	ch.purgeExpired()
 	if len(ch.data) > 0 {
-		// answer with currently waiting data
-		resp <- ch.data
-		// remove data as it is already sent back
-		ch.data = nil
-		// earlier Get should get nothing, this one comes back with data immediately,
-		// thus no get notifier for Publish
-		ch.notif = nil
+		// answer with currently waiting data, removing it as it is already sent back
+		resp <- ch.take(opts)
 		return true
 	}
 	return false
 }
 
-func (ch *Channel) onNewDataLocking(resp chan []interface{}, notif *getnotifier) {
+func (ch *Channel) onNewDataLocking(resp chan *Batch, notif *getnotifier, opts GetOptions) {
 	ch.mx.Lock()
 	defer ch.mx.Unlock()
-	// answer with currently waiting data
-	resp <- ch.data
-	// remove data as it is already sent back
-	ch.data = nil
+	if notif.batch != nil {
+		// served by another Get in the broadcast mode
+		resp <- notif.batch
+		return
+	}
 	// remove this Get from Publish notification as this Get is already processed
-	if ch.notif == notif {
-		ch.notif = nil
+	if !ch.unwait(notif) {
+		// kicked out by another Get or dropped
+		resp <- ch.empty()
+		return
+	}
+	ch.purgeExpired()
+	// answer with currently waiting data, removing it as it is already sent back
+	batch := ch.take(opts)
+	resp <- batch
+	if ch.mode == GetBroadcast {
+		for _, other := range ch.waiting {
+			other.batch = batch
+			other.notify()
+		}
+		ch.waiting = nil
+	} else if len(ch.data) > 0 {
+		// let the next one in the queue pick up the remainder
+		ch.notify()
 	}
 }
 
-func (ch *Channel) onLongpollTimeoutLocking(resp chan []interface{}, notif *getnotifier) {
+func (ch *Channel) onLongpollTimeoutLocking(resp chan *Batch, notif *getnotifier, opts GetOptions) {
+	ch.mx.Lock()
+	pinged := notif.pinged
+	ch.mx.Unlock()
+	if pinged {
+		// data arrived concurrently with the timeout
+		ch.onNewDataLocking(resp, notif, opts)
+		return
+	}
 	ch.mx.Lock()
 	defer ch.mx.Unlock()
-	// asnwer with no data
-	resp <- nil
 	// remove this Get from Publish notification as this Get is already processed
-	if ch.notif == notif {
-		ch.notif = nil
+	ch.unwait(notif)
+	// asnwer with no data
+	resp <- ch.empty()
+}
+
+// onCancelLocking unregisters a Get cancelled by its context without taking any data.
+func (ch *Channel) onCancelLocking(resp chan *Batch, notif *getnotifier) {
+	ch.mx.Lock()
+	defer ch.mx.Unlock()
+	if notif.batch != nil {
+		// served by another Get in the broadcast mode
+		resp <- notif.batch
+		return
+	}
+	if ch.unwait(notif) && len(ch.data) > 0 {
+		// the data may have been notified to this Get: hand it over to the next waiting one
+		ch.notify()
+	}
+	resp <- ch.empty()
+}
+
+// restore puts the messages of a batch that could not be delivered back to the front of the queue,
+// unless the batch was shared by all Gets in the GetBroadcast mode.
+func (ch *Channel) restore(batch *Batch) {
+	if len(batch.Messages) == 0 {
+		return
+	}
+	ch.mx.Lock()
+	defer ch.mx.Unlock()
+	if !ch.IsAlive() || ch.mode == GetBroadcast {
+		return
+	}
+	// the messages are older than those queued since, thus ahead of them within the same priority
+	data := append(append(make([]*Message, 0, len(batch.Messages)+len(ch.data)), batch.Messages...), ch.data...)
+	sort.SliceStable(data, func(i, j int) bool { return data[i].priority > data[j].priority })
+	ch.data = data
+	atomic.AddUint64(&ch.sent, ^uint64(len(batch.Messages)-1))
+	ch.notify()
+}
+
+// take removes the leading messages within the limits from the queue and returns them as a batch.
+// At least one message is taken if available. Must be called under lock.
+func (ch *Channel) take(opts GetOptions) *Batch {
+	n := len(ch.data)
+	if opts.MaxMessages > 0 && n > opts.MaxMessages {
+		n = opts.MaxMessages
+	}
+	if opts.MaxBytes > 0 {
+		bytes := 0
+		for i := 0; i < n; i++ {
+			bytes += ch.data[i].size()
+			if bytes > opts.MaxBytes && i > 0 {
+				n = i
+				break
+			}
+		}
+	}
+	res := ch.empty()
+	atomic.AddUint64(&ch.sent, uint64(n))
+	if n == len(ch.data) {
+		res.Messages = ch.data
+		ch.data = nil
+		return res
+	}
+	res.Messages = ch.data[:n:n]
+	res.More = true
+	ch.data = ch.data[n:]
+	return res
+}
+
+// purgeExpired removes messages with elapsed TTL from the queue. Must be called under lock.
+func (ch *Channel) purgeExpired() {
+	now := time.Now()
+	var res []*Message
+	for i, msg := range ch.data {
+		ttl := msg.ttl
+		if ttl == 0 {
+			ttl = ch.ttl
+		}
+		if ttl > 0 && now.Sub(msg.Time) >= ttl {
+			if res == nil {
+				res = append(make([]*Message, 0, len(ch.data)), ch.data[:i]...)
+			}
+			atomic.AddUint64(&ch.expired, 1)
+		} else if res != nil {
+			res = append(res, msg)
+		}
+	}
+	if res != nil {
+		ch.data = res
 	}
 }
 
@@ -231,34 +612,205 @@ func (ch *Channel) IsAlive() bool {
 
 // Drop terminates any publishing and receiving on the channel, signals the currently waiting Get
 // request to return empty, terminates the timeout timer and runs the exit handler if supplied.
+// The queued data is discarded and counted as dropped before Drop returns, while the exit handler
+// runs asynchronously.
 func (ch *Channel) Drop() {
+	// prevent any external changes to data, new subscriptions
+	ch.mx.Lock()
 	if !ch.IsAlive() {
+		ch.mx.Unlock()
 		return
 	}
 	atomic.StoreInt32(&ch.alive, no)
 
-	go func() {
-		// prevent any external changes to data, new subscriptions
-		ch.mx.Lock()
-		defer ch.mx.Unlock()
+	// signal timeout handler to quit
+	ch.tor.Drop()
+	// clear data: no subscription gets anything
+	atomic.AddUint64(&ch.dropped, uint64(len(ch.data)))
+	ch.data = nil
+	// let current gets know that they should quit (with no data, see above)
+	for _, notif := range ch.waiting {
+		notif.notify()
+	}
+	// tell publish that there is no get listening, let it quit
+	ch.waiting = nil
 
-		// signal timeout handler to quit
-		ch.tor.Drop()
-		// clear data: no subscription gets anything
-		ch.data = nil
-		// let current get know that it should quit (with no data, see above)
-		if ch.notif != nil && !ch.notif.pinged {
-			ch.notif.ping <- true
-		}
-		// tell publish that there is no get listening, let it quit
-		ch.notif = nil
-		// execute callback (e.g. removing from pubsub subscriptions map)
-		if ch.onClose != nil {
+	// execute callback (e.g. removing from pubsub subscriptions map) outside of the lock as it
+	// may lock the pubsub, which in turn locks channels, e.g. to seed new ones, and in a goroutine
+	// as the pubsub may be locked by the caller, e.g. on close
+	if ch.onClose != nil {
+		ch.track(func() {
 			ch.onClose(ch.id)
-		}
+		})
+	}
+	ch.mx.Unlock()
+}
+
+// expire drops the channel on timeout.
+func (ch *Channel) expire() {
+	atomic.StoreInt32(&ch.lapsed, yes)
+	ch.Drop()
+}
+
+// timedOut tests if the channel was dropped by the timeout.
+func (ch *Channel) timedOut() bool {
+	return atomic.LoadInt32(&ch.lapsed) == yes
+}
+
+// spawn runs f in a goroutine tracked for wait unless the channel has been dropped, and reports
+// whether it did. Goroutines are added only while the channel is alive and under the lock taken
+// by Drop, so that none is added once wait may be waiting.
+func (ch *Channel) spawn(f func()) bool {
+	ch.mx.Lock()
+	defer ch.mx.Unlock()
+	if !ch.IsAlive() {
+		return false
+	}
+	ch.track(f)
+	return true
+}
+
+// track runs f in a goroutine tracked for wait. Must be called under lock.
+func (ch *Channel) track(f func()) {
+	ch.wg.Add(1)
+	go func() {
+		defer ch.wg.Done()
+		f()
 	}()
 }
 
+// wait blocks until all goroutines of a dropped channel have exited. Must be called after Drop.
+func (ch *Channel) wait() {
+	<-ch.tor.exited
+	ch.wg.Wait()
+}
+
+// empty creates a batch with no data.
+func (ch *Channel) empty() *Batch {
+	return &Batch{GoingAway: ch.isGoingAway()}
+}
+
+// goAway lets all waiting and future Get requests return immediately with whatever is queued,
+// flagging the responses with GoingAway.
+func (ch *Channel) goAway() {
+	ch.mx.Lock()
+	defer ch.mx.Unlock()
+	atomic.StoreInt32(&ch.away, yes)
+	for _, notif := range ch.waiting {
+		notif.notify()
+	}
+}
+
+func (ch *Channel) isGoingAway() bool {
+	return atomic.LoadInt32(&ch.away) == yes
+}
+
+// SetGetMode sets the way data is distributed across concurrent Get requests, see GetMode.
+func (ch *Channel) SetGetMode(mode GetMode) {
+	ch.mx.Lock()
+	ch.mode = mode
+	ch.mx.Unlock()
+}
+
+// SetTTL sets the default time to live for messages in the queue of this channel, which do not
+// define their own TTL. Expired messages are discarded undelivered. Zero, the default, means
+// messages do not expire.
+func (ch *Channel) SetTTL(ttl time.Duration) {
+	ch.mx.Lock()
+	ch.ttl = ttl
+	ch.mx.Unlock()
+}
+
+// SetFilter sets the filter deciding which of the messages published to matching topics are
+// queued; nil accepts all of them. Rejected messages are discarded and counted in Stats. Messages
+// already queued are not affected.
+func (ch *Channel) SetFilter(filter Filter) {
+	ch.mx.Lock()
+	ch.filter = filter
+	ch.mx.Unlock()
+}
+
+// SetTransform sets the transform applied to the data of messages when they are queued, after
+// filtering; nil queues the data as published. Messages already queued are not affected.
+func (ch *Channel) SetTransform(transform Transform) {
+	ch.mx.Lock()
+	ch.reshape = transform
+	ch.mx.Unlock()
+}
+
+// SetOwner records the principal owning the subscription, for introspection only, see Info.
+func (ch *Channel) SetOwner(owner string) {
+	ch.owner.Store(owner)
+}
+
+// Owner returns the principal owning the subscription, empty if not known.
+func (ch *Channel) Owner() string {
+	// no locking: read by LongPoll under its lock
+	res, _ := ch.owner.Load().(string)
+	return res
+}
+
+// SetLabels attaches the labels to the channel replacing any set earlier, see Selector. The
+// labels are copied.
+func (ch *Channel) SetLabels(labels map[string]string) {
+	res := make(map[string]string, len(labels))
+	for key, value := range labels {
+		res[key] = value
+	}
+	ch.tags.Store(res)
+}
+
+// Labels returns a copy of the labels of the channel.
+func (ch *Channel) Labels() map[string]string {
+	res := make(map[string]string)
+	for key, value := range ch.labels() {
+		res[key] = value
+	}
+	return res
+}
+
+// labels returns the labels of the channel without copying; the map is never modified.
+func (ch *Channel) labels() map[string]string {
+	res, _ := ch.tags.Load().(map[string]string)
+	return res
+}
+
+// Stats returns the message counters of the channel.
+func (ch *Channel) Stats() Stats {
+	return Stats{
+		Delivered: atomic.LoadUint64(&ch.sent),
+		Expired:   atomic.LoadUint64(&ch.expired),
+		Conflated: atomic.LoadUint64(&ch.merged),
+		Filtered:  atomic.LoadUint64(&ch.skipped),
+		Dropped:   atomic.LoadUint64(&ch.dropped),
+	}
+}
+
+// Info returns a snapshot of the channel state for introspection.
+func (ch *Channel) Info() ChannelInfo {
+	res := ChannelInfo{
+		ID:        ch.id,
+		Topics:    ch.Topics(),
+		Owner:     ch.Owner(),
+		Labels:    ch.Labels(),
+		Created:   ch.created,
+		ExpiresIn: ch.tor.Remaining(),
+		Stats:     ch.Stats(),
+	}
+	sort.Strings(res.Topics)
+	if lastget := atomic.LoadInt64(&ch.lastget); lastget > 0 {
+		res.LastGet = time.Unix(0, lastget)
+	}
+	ch.mx.Lock()
+	res.QueueSize = len(ch.data)
+	for _, msg := range ch.data {
+		res.QueueBytes += msg.size()
+	}
+	res.GetWaiting = len(ch.waiting) > 0
+	ch.mx.Unlock()
+	return res
+}
+
 // ID returns the channel/subscription Id assigned at construction.
 func (ch *Channel) ID() string {
 	return ch.id
@@ -283,8 +835,33 @@ func (ch *Channel) QueueSize() int {
 	return res
 }
 
+// Queue returns a copy of the currently queued messages in the order of delivery.
+func (ch *Channel) Queue() []*Message {
+	ch.mx.Lock()
+	defer ch.mx.Unlock()
+	return append([]*Message(nil), ch.data...)
+}
+
+// Purge discards all queued messages, counting them as dropped, and returns their number.
+func (ch *Channel) Purge() int {
+	ch.mx.Lock()
+	defer ch.mx.Unlock()
+	res := len(ch.data)
+	atomic.AddUint64(&ch.dropped, uint64(res))
+	ch.data = nil
+	return res
+}
+
 // IsGetWaiting reports if there is a Get request waiting for data.
 func (ch *Channel) IsGetWaiting() bool {
-	// do not synchronise
-	return ch.notif != nil
+	ch.mx.Lock()
+	defer ch.mx.Unlock()
+	return len(ch.waiting) > 0
+}
+
+// drained tests if the queue is empty and no Get request is waiting.
+func (ch *Channel) drained() bool {
+	ch.mx.Lock()
+	defer ch.mx.Unlock()
+	return len(ch.data) == 0 && len(ch.waiting) == 0
 }
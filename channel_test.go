@@ -4,6 +4,7 @@
 package longpoll_test
 
 import (
+	"context"
 	"sort"
 	"testing"
 	"time"
@@ -496,3 +497,534 @@ func TestChannel_onDropRightAfterGet_GetReturnsEmpty(t *testing.T) {
 		t.Errorf("get returned late")
 	}
 }
+
+func TestChannel_onPublishSync_queuedInOrder(t *testing.T) {
+	timeout := 400 * time.Millisecond
+	polltime := 200 * time.Millisecond
+
+	ch := longpoll.MustNewChannel(timeout, nil, "A", "B")
+	defer ch.Drop()
+
+	for i := 0; i < 100; i++ {
+		if ok, err := ch.PublishSync(i, "A"); !ok || err != nil {
+			t.Fatalf("expected data accepted, %v", err)
+		}
+	}
+	if ch.QueueSize() != 100 {
+		t.Errorf("expected data queued upon return")
+	}
+	datach, _ := ch.Get(polltime)
+	data := <-datach
+	for i, d := range data {
+		if d != i {
+			t.Fatalf("unexpected order of data")
+		}
+	}
+}
+
+func TestChannel_onPublishSync_withNonmatchingTopic_notAccepted(t *testing.T) {
+	ch := longpoll.MustNewChannel(400*time.Millisecond, nil, "A")
+	defer ch.Drop()
+
+	ok, err := ch.PublishSync(&pubdata{value: 1}, "B")
+	if ok || err != nil {
+		t.Errorf("expected data not accepted without error")
+	}
+	if ch.QueueSize() != 0 {
+		t.Errorf("unexpected queue size")
+	}
+}
+
+func TestChannel_onPublishSync_whenGetWaiting_GetComesBackUponPublish(t *testing.T) {
+	polltime := 200 * time.Millisecond
+	tolerance := 25 * time.Millisecond
+
+	ch := longpoll.MustNewChannel(400*time.Millisecond, nil, "A")
+	defer ch.Drop()
+
+	datach, _ := ch.Get(polltime)
+	time.Sleep(tolerance)
+
+	start := time.Now()
+	outdata := pubdata{value: 351}
+	ch.PublishSync(&outdata, "A")
+	data := <-datach
+	if time.Now().Sub(start) > tolerance {
+		t.Errorf("get returned late")
+	}
+	if len(data) != 1 || data[0] != &outdata {
+		t.Errorf("unexpected data in get")
+	}
+}
+
+func TestChannel_onDroppedSub_PublishSyncErrors(t *testing.T) {
+	ch := longpoll.MustNewChannel(400*time.Millisecond, nil, "A")
+	ch.Drop()
+
+	ok, err := ch.PublishSync(&pubdata{value: 1}, "A")
+	if ok || err == nil {
+		t.Errorf("error expected")
+	}
+}
+
+func TestChannel_onGetMessages_deliversEnvelopes(t *testing.T) {
+	ch := longpoll.MustNewChannel(400*time.Millisecond, nil, "A", "B")
+	defer ch.Drop()
+
+	before := time.Now()
+	ch.PublishSync("a", "A")
+	ch.PublishSync("b", "B")
+	msgch, _ := ch.GetMessages(200 * time.Millisecond)
+	msgs := <-msgch
+	if len(msgs) != 2 || msgs[0].Data != "a" || msgs[1].Topic != "B" {
+		t.Fatalf("unexpected messages %v", msgs)
+	}
+	if msgs[0].Seq >= msgs[1].Seq {
+		t.Error("expected increasing sequence numbers")
+	}
+	if msgs[0].Time.Before(before) {
+		t.Error("expected publishing time")
+	}
+}
+
+func TestChannel_onExpiredTTL_messagesPurgedAndCounted(t *testing.T) {
+	ch := longpoll.MustNewChannel(time.Second, nil, "A")
+	defer ch.Drop()
+	ch.SetTTL(100 * time.Millisecond)
+
+	ch.PublishSync("default", "A")
+	ch.PublishWith("long", "A", longpoll.PublishOptions{TTL: time.Minute})
+	ch.PublishWith("short", "A", longpoll.PublishOptions{TTL: 50 * time.Millisecond})
+	time.Sleep(150 * time.Millisecond)
+	ch.PublishSync("fresh", "A")
+
+	datach, _ := ch.Get(200 * time.Millisecond)
+	data := <-datach
+	if len(data) != 2 || data[0] != "long" || data[1] != "fresh" {
+		t.Errorf("expected expired messages purged, found %v", data)
+	}
+	if ch.Stats().Expired != 2 {
+		t.Errorf("expected 2 expired messages, found %v", ch.Stats().Expired)
+	}
+}
+
+func TestChannel_onAllExpired_GetWaitsForNewData(t *testing.T) {
+	polltime := 200 * time.Millisecond
+	tolerance := 25 * time.Millisecond
+
+	ch := longpoll.MustNewChannel(time.Second, nil, "A")
+	defer ch.Drop()
+
+	ch.PublishWith("stale", "A", longpoll.PublishOptions{TTL: tolerance})
+	time.Sleep(2 * tolerance)
+
+	start := time.Now()
+	datach, _ := ch.Get(polltime)
+	if data := <-datach; len(data) > 0 {
+		t.Errorf("unexpected data in get: %v", data)
+	}
+	if time.Now().Sub(start) < polltime {
+		t.Errorf("get returned before polltime")
+	}
+}
+
+func TestChannel_onPublishWithKey_conflatesUndelivered(t *testing.T) {
+	ch := longpoll.MustNewChannel(time.Second, nil, "A", "B")
+	defer ch.Drop()
+
+	ch.PublishWith("eur1", "A", longpoll.PublishOptions{Key: "EUR"})
+	ch.PublishWith("usd1", "A", longpoll.PublishOptions{Key: "USD"})
+	ch.PublishSync("plain", "A")
+	ch.PublishWith("eur2", "A", longpoll.PublishOptions{Key: "EUR"})
+	ch.PublishWith("eurB", "B", longpoll.PublishOptions{Key: "EUR"})
+	ch.PublishWith("eur3", "A", longpoll.PublishOptions{Key: "EUR"})
+
+	datach, _ := ch.Get(200 * time.Millisecond)
+	data := <-datach
+	if len(data) != 4 || data[0] != "eur3" || data[1] != "usd1" || data[2] != "plain" || data[3] != "eurB" {
+		t.Errorf("expected latest value per key and topic in place, found %v", data)
+	}
+	if ch.Stats().Conflated != 2 {
+		t.Errorf("expected 2 conflated messages, found %v", ch.Stats().Conflated)
+	}
+
+	// delivered messages are not conflated
+	ch.PublishWith("eur4", "A", longpoll.PublishOptions{Key: "EUR"})
+	datach, _ = ch.Get(200 * time.Millisecond)
+	if data = <-datach; len(data) != 1 || data[0] != "eur4" {
+		t.Errorf("unexpected data in get: %v", data)
+	}
+}
+
+func TestChannel_onPollWithMaxMessages_remainderQueued(t *testing.T) {
+	ch := longpoll.MustNewChannel(time.Second, nil, "A")
+	defer ch.Drop()
+	for i := 0; i < 5; i++ {
+		ch.PublishSync(i, "A")
+	}
+
+	opts := longpoll.GetOptions{MaxMessages: 2}
+	var received []interface{}
+	for i := 0; i < 3; i++ {
+		batchch, _ := ch.Poll(200*time.Millisecond, opts)
+		batch := <-batchch
+		if batch.More != (i < 2) {
+			t.Errorf("unexpected more flag in batch %v", i)
+		}
+		for _, msg := range batch.Messages {
+			received = append(received, msg.Data)
+		}
+	}
+	if len(received) != 5 || received[0] != 0 || received[4] != 4 {
+		t.Errorf("expected all data in order, found %v", received)
+	}
+}
+
+func TestChannel_onPollWithMaxBytes_limitsResponse(t *testing.T) {
+	ch := longpoll.MustNewChannel(time.Second, nil, "A")
+	defer ch.Drop()
+	ch.PublishSync(make([]byte, 600), "A")
+	ch.PublishSync("0123456789", "A")
+	ch.PublishSync(make([]byte, 300), "A")
+
+	opts := longpoll.GetOptions{MaxBytes: 500}
+	batchch, _ := ch.Poll(200*time.Millisecond, opts)
+	if batch := <-batchch; len(batch.Messages) != 1 || !batch.More {
+		t.Error("expected oversized message alone")
+	}
+	batchch, _ = ch.Poll(200*time.Millisecond, opts)
+	if batch := <-batchch; len(batch.Messages) != 2 || batch.More {
+		t.Error("expected remaining messages within limit")
+	}
+	batchch, _ = ch.Poll(50*time.Millisecond, opts)
+	if batch := <-batchch; batch == nil || len(batch.Messages) != 0 {
+		t.Error("expected empty batch")
+	}
+}
+
+func TestChannel_onPollWithLinger_collectsBurst(t *testing.T) {
+	linger := 100 * time.Millisecond
+	tolerance := 25 * time.Millisecond
+
+	ch := longpoll.MustNewChannel(time.Second, nil, "A")
+	defer ch.Drop()
+
+	batchch, _ := ch.Poll(time.Second, longpoll.GetOptions{Linger: linger})
+	time.Sleep(tolerance)
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		ch.PublishSync(i, "A")
+		time.Sleep(tolerance / 5)
+	}
+	batch := <-batchch
+	if len(batch.Messages) != 5 {
+		t.Errorf("expected the burst in one batch, found %v", len(batch.Messages))
+	}
+	if elapsed := time.Now().Sub(start); elapsed < linger || elapsed > linger+tolerance {
+		t.Errorf("expected response after linger, found %v", elapsed)
+	}
+}
+
+func TestChannel_onPollWithLinger_returnsUponMaxMessages(t *testing.T) {
+	tolerance := 25 * time.Millisecond
+
+	ch := longpoll.MustNewChannel(time.Second, nil, "A")
+	defer ch.Drop()
+
+	batchch, _ := ch.Poll(time.Second, longpoll.GetOptions{Linger: time.Second, MaxMessages: 3})
+	time.Sleep(tolerance)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		ch.PublishSync(i, "A")
+	}
+	batch := <-batchch
+	if len(batch.Messages) != 3 || batch.More {
+		t.Errorf("expected a full batch, found %v", len(batch.Messages))
+	}
+	if time.Now().Sub(start) > tolerance {
+		t.Errorf("get returned late")
+	}
+}
+
+func TestChannel_onPollWithLinger_kickedByNextGet(t *testing.T) {
+	tolerance := 25 * time.Millisecond
+
+	ch := longpoll.MustNewChannel(time.Second, nil, "A")
+	defer ch.Drop()
+
+	batchch, _ := ch.Poll(time.Second, longpoll.GetOptions{Linger: time.Second})
+	time.Sleep(tolerance)
+	ch.PublishSync(1, "A")
+	time.Sleep(tolerance)
+	start := time.Now()
+	datach, _ := ch.Get(time.Second)
+	batch := <-batchch
+	data := <-datach
+	if time.Now().Sub(start) > tolerance {
+		t.Errorf("get returned late")
+	}
+	if len(batch.Messages)+len(data) != 1 {
+		t.Errorf("expected data delivered exactly once")
+	}
+}
+
+func TestChannel_onPublishWithPriority_deliveredFirstInOrder(t *testing.T) {
+	ch := longpoll.MustNewChannel(time.Second, nil, "A")
+	defer ch.Drop()
+
+	ch.PublishSync("r1", "A")
+	ch.PublishWith("c1", "A", longpoll.PublishOptions{Priority: 10})
+	ch.PublishSync("r2", "A")
+	ch.PublishWith("w1", "A", longpoll.PublishOptions{Priority: 5})
+	ch.PublishWith("c2", "A", longpoll.PublishOptions{Priority: 10})
+	ch.PublishWith("l1", "A", longpoll.PublishOptions{Priority: -1})
+
+	batchch, _ := ch.Poll(200*time.Millisecond, longpoll.GetOptions{MaxMessages: 3})
+	batch := <-batchch
+	datach, _ := ch.Get(200 * time.Millisecond)
+	data := append(payloads(batch.Messages), <-datach...)
+	expected := []interface{}{"c1", "c2", "w1", "r1", "r2", "l1"}
+	if len(data) != len(expected) {
+		t.Fatalf("unexpected data %v", data)
+	}
+	for i := range expected {
+		if data[i] != expected[i] {
+			t.Fatalf("expected %v, found %v", expected, data)
+		}
+	}
+}
+
+func TestChannel_onConflateWithOtherPriority_repositioned(t *testing.T) {
+	ch := longpoll.MustNewChannel(time.Second, nil, "A")
+	defer ch.Drop()
+
+	ch.PublishWith("k1", "A", longpoll.PublishOptions{Key: "k"})
+	ch.PublishSync("r1", "A")
+	ch.PublishWith("k2", "A", longpoll.PublishOptions{Key: "k", Priority: 1})
+
+	datach, _ := ch.Get(200 * time.Millisecond)
+	data := <-datach
+	if len(data) != 2 || data[0] != "k2" || data[1] != "r1" {
+		t.Errorf("unexpected data %v", data)
+	}
+}
+
+func payloads(msgs []*longpoll.Message) []interface{} {
+	var res []interface{}
+	for _, msg := range msgs {
+		res = append(res, msg.Data)
+	}
+	return res
+}
+
+func TestChannel_onGetQueueMode_concurrentGetsServedInOrder(t *testing.T) {
+	polltime := 400 * time.Millisecond
+	tolerance := 25 * time.Millisecond
+
+	ch := longpoll.MustNewChannel(time.Second, nil, "A")
+	defer ch.Drop()
+	ch.SetGetMode(longpoll.GetQueue)
+
+	datach1, _ := ch.Get(polltime)
+	time.Sleep(tolerance)
+	datach2, _ := ch.Get(polltime)
+	time.Sleep(tolerance)
+
+	start := time.Now()
+	ch.PublishSync(1, "A")
+	if data := <-datach1; len(data) != 1 || data[0] != 1 {
+		t.Errorf("expected data on the first get, found %v", data)
+	}
+	if time.Now().Sub(start) > tolerance {
+		t.Errorf("get1 returned late")
+	}
+	ch.PublishSync(2, "A")
+	if data := <-datach2; len(data) != 1 || data[0] != 2 {
+		t.Errorf("expected data on the second get, found %v", data)
+	}
+	if time.Now().Sub(start) > tolerance {
+		t.Errorf("get2 returned late")
+	}
+}
+
+func TestChannel_onGetQueueMode_remainderPickedByNextGet(t *testing.T) {
+	tolerance := 25 * time.Millisecond
+
+	ch := longpoll.MustNewChannel(time.Second, nil, "A")
+	defer ch.Drop()
+	ch.SetGetMode(longpoll.GetQueue)
+
+	batchch1, _ := ch.Poll(time.Second, longpoll.GetOptions{MaxMessages: 1, Linger: tolerance})
+	time.Sleep(tolerance)
+	batchch2, _ := ch.Poll(time.Second, longpoll.GetOptions{})
+	time.Sleep(tolerance)
+	ch.PublishSync(1, "A")
+	ch.PublishSync(2, "A")
+
+	batch1 := <-batchch1
+	batch2 := <-batchch2
+	if len(batch1.Messages) != 1 || batch1.Messages[0].Data != 1 || !batch1.More {
+		t.Errorf("unexpected first batch %v", batch1)
+	}
+	if len(batch2.Messages) != 1 || batch2.Messages[0].Data != 2 {
+		t.Errorf("unexpected second batch %v", batch2)
+	}
+}
+
+func TestChannel_onGetBroadcastMode_allGetsReceive(t *testing.T) {
+	tolerance := 25 * time.Millisecond
+
+	ch := longpoll.MustNewChannel(time.Second, nil, "A")
+	defer ch.Drop()
+	ch.SetGetMode(longpoll.GetBroadcast)
+
+	var datachs []chan []interface{}
+	for i := 0; i < 3; i++ {
+		datach, _ := ch.Get(400 * time.Millisecond)
+		datachs = append(datachs, datach)
+	}
+	time.Sleep(tolerance)
+	outdata := pubdata{value: 351}
+	ch.PublishSync(&outdata, "A")
+	for i, datach := range datachs {
+		if data := <-datach; len(data) != 1 || data[0] != &outdata {
+			t.Errorf("expected data on get %v", i)
+		}
+	}
+	if ch.IsGetWaiting() || ch.QueueSize() != 0 {
+		t.Error("expected no waiting gets and no queued data")
+	}
+}
+
+func TestChannel_onGetBroadcastMode_dropReturnsAllGets(t *testing.T) {
+	tolerance := 25 * time.Millisecond
+
+	ch := longpoll.MustNewChannel(time.Second, nil, "A")
+	ch.SetGetMode(longpoll.GetBroadcast)
+
+	datach1, _ := ch.Get(time.Second)
+	datach2, _ := ch.Get(time.Second)
+	time.Sleep(tolerance)
+	start := time.Now()
+	ch.Drop()
+	if len(<-datach1)+len(<-datach2) > 0 {
+		t.Error("data coming from nowhere")
+	}
+	if time.Now().Sub(start) > tolerance {
+		t.Error("gets returned late")
+	}
+}
+
+func TestChannel_onInfo_snapshotsState(t *testing.T) {
+	ch := longpoll.MustNewChannel(time.Minute, nil, "B", "A")
+	defer ch.Drop()
+	ch.SetOwner("alice")
+
+	info := ch.Info()
+	if info.ID != ch.ID() || len(info.Topics) != 2 || info.Topics[0] != "A" || info.Owner != "alice" {
+		t.Errorf("unexpected info %v", info)
+	}
+	if !info.LastGet.IsZero() || info.Created.IsZero() || info.ExpiresIn <= 59*time.Second {
+		t.Errorf("unexpected times %v", info)
+	}
+
+	ch.PublishSync("abc", "A")
+	ch.PublishSync([]byte("de"), "B")
+	info = ch.Info()
+	if info.QueueSize != 2 || info.QueueBytes != 5 || info.GetWaiting {
+		t.Errorf("unexpected queue %v", info)
+	}
+
+	datach, _ := ch.Get(time.Second)
+	<-datach
+	ch.Get(time.Second)
+	time.Sleep(25 * time.Millisecond)
+	info = ch.Info()
+	if info.QueueSize != 0 || !info.GetWaiting || info.Delivered != 2 || info.LastGet.IsZero() {
+		t.Errorf("unexpected info after get %v", info)
+	}
+}
+
+func TestChannel_onDrop_queueCountedAsDropped(t *testing.T) {
+	ch := longpoll.MustNewChannel(time.Minute, nil, "A")
+	ch.PublishSync(1, "A")
+	ch.PublishSync(2, "A")
+	ch.Drop()
+	if stats := ch.Stats(); stats.Dropped != 2 || stats.Delivered != 0 {
+		t.Errorf("unexpected stats %v", stats)
+	}
+}
+
+func TestChannel_onFilter_discardsBeforeQueueing(t *testing.T) {
+	ch := longpoll.MustNewChannel(time.Minute, nil, "A")
+	defer ch.Drop()
+	ch.SetFilter(func(msg *longpoll.Message) bool {
+		return msg.Data.(int)%2 == 0
+	})
+	for i := 0; i < 5; i++ {
+		ok, err := ch.PublishSync(i, "A")
+		if err != nil || ok != (i%2 == 0) {
+			t.Errorf("unexpected publish result for %v: %v, %v", i, ok, err)
+		}
+	}
+	if ch.QueueSize() != 3 || ch.Stats().Filtered != 2 {
+		t.Errorf("expected 3 queued and 2 filtered, found %v and %v", ch.QueueSize(), ch.Stats().Filtered)
+	}
+	datach, _ := ch.Get(time.Second)
+	if data := <-datach; len(data) != 3 || data[1] != 2 {
+		t.Errorf("unexpected data %v", data)
+	}
+}
+
+func TestChannel_onPollContextCancelled_returnsWithoutTakingData(t *testing.T) {
+	ch := longpoll.MustNewChannel(time.Minute, nil, "A")
+	defer ch.Drop()
+	ctx, cancel := context.WithCancel(context.Background())
+	batchch, _ := ch.PollContext(ctx, time.Minute, longpoll.GetOptions{})
+	time.Sleep(10 * time.Millisecond)
+
+	start := time.Now()
+	cancel()
+	select {
+	case batch := <-batchch:
+		if len(batch.Messages) != 0 {
+			t.Errorf("unexpected data %v", batch.Messages)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected cancelled Poll to return")
+	}
+	if time.Since(start) > 100*time.Millisecond || ch.IsGetWaiting() {
+		t.Error("expected cancelled Poll unregistered promptly")
+	}
+	ch.PublishSync("a", "A")
+	if ch.QueueSize() != 1 {
+		t.Errorf("expected data queued for the next Poll, found %d", ch.QueueSize())
+	}
+}
+
+func TestChannel_onGetQueueModePollCancelled_nextGetReceives(t *testing.T) {
+	ch := longpoll.MustNewChannel(time.Minute, nil, "A")
+	defer ch.Drop()
+	ch.SetGetMode(longpoll.GetQueue)
+	ctx, cancel := context.WithCancel(context.Background())
+	first, _ := ch.PollContext(ctx, time.Minute, longpoll.GetOptions{Linger: 200 * time.Millisecond})
+	time.Sleep(10 * time.Millisecond)
+	second, _ := ch.Poll(time.Second, longpoll.GetOptions{})
+	time.Sleep(10 * time.Millisecond)
+
+	// the first one is notified and lingers when cancelled
+	ch.PublishSync("a", "A")
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	if batch := <-first; len(batch.Messages) != 0 {
+		t.Errorf("unexpected data in cancelled Poll %v", batch.Messages)
+	}
+	select {
+	case batch := <-second:
+		if len(batch.Messages) != 1 || batch.Messages[0].Data != "a" {
+			t.Errorf("unexpected batch %v", batch.Messages)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Error("expected the next Get to receive the data")
+	}
+}
@@ -0,0 +1,319 @@
+// Copyright (c) 2015-2017. Oleg Sklyar & teris.io. All rights reserved.
+// See the LICENSE file in the project root for licensing information.
+
+// Package client provides a Go client consuming a long-polling endpoint served by
+// longpoll.Handler. The client subscribes, polls in a loop, reconnects with exponential backoff
+// and jitter on failures, and subscribes anew when the server no longer knows the subscription or
+// is going away, resuming from the sequence number of the last received message, or after its
+// time of publishing when the server is going away as sequence numbers only hold against the
+// same server instance.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Message represents a message received from the server. The data is kept in its JSON encoding
+// for the caller to unmarshal into the expected type.
+type Message struct {
+	Seq   uint64          `json:"seq"`
+	Topic string          `json:"topic"`
+	Time  time.Time       `json:"time"`
+	Data  json.RawMessage `json:"data"`
+}
+
+// Options define optional properties of a Client. Zero values are replaced by defaults.
+type Options struct {
+	// HTTPClient performs the requests, http.DefaultClient by default.
+	HTTPClient *http.Client
+	// Timeout is the subscription timeout requested from the server, server default if zero.
+	Timeout time.Duration
+	// PollTime is the long-polling interval requested from the server, 30s by default.
+	PollTime time.Duration
+	// MaxMessages limits the number of messages per response, no limit if zero.
+	MaxMessages int
+	// MinBackoff is the initial delay before retrying a failed request, 100ms by default.
+	MinBackoff time.Duration
+	// MaxBackoff caps the exponentially growing delay before retrying, 30s by default.
+	MaxBackoff time.Duration
+	// Since is the sequence number of the last message received earlier, if any, to resume from.
+	// Sequence numbers are only meaningful to the server instance that published the message.
+	Since uint64
+	// Filter is an expression selecting the messages to receive, see longpoll.ParseFilter.
+	Filter string
+	// Fields limits the data of received messages to the given fields, see longpoll.Project.
+	Fields []string
+	// Labels are attached to the subscription, see longpoll.SubscribeOptions.
+	Labels map[string]string
+}
+
+// Client consumes messages published to the given topics from a long-polling endpoint. Its methods
+// must not be called concurrently.
+type Client struct {
+	baseURL string
+	topics  []string
+	opts    Options
+	id      string
+	cursor  uint64    // last message returned
+	fetched uint64    // latest message received from the server, zero after it went away
+	latest  time.Time // publishing time of the latest message received
+	pending []*Message
+	retries int
+	rnd     *rand.Rand
+}
+
+// StatusError reports an unexpected HTTP response status.
+type StatusError struct {
+	Code int
+	Msg  string
+	// RetryAfter is the delay requested by the server in the Retry-After header, if any.
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status %d: %s", e.Code, e.Msg)
+}
+
+// New creates a client for the endpoint at baseURL, the prefix under which longpoll.Handler is
+// mounted, subscribing to the given topics. No requests are made until messages are requested.
+func New(baseURL string, opts Options, topics ...string) (*Client, error) {
+	if len(topics) == 0 {
+		return nil, errors.New("at least one topic expected")
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = http.DefaultClient
+	}
+	if opts.PollTime <= 0 {
+		opts.PollTime = 30 * time.Second
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = 100 * time.Millisecond
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = 30 * time.Second
+	}
+	return &Client{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		topics:  topics,
+		opts:    opts,
+		cursor:  opts.Since,
+		fetched: opts.Since,
+		rnd:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}, nil
+}
+
+// Next returns the next message, polling the server as long as necessary. Failed requests are
+// retried with backoff until the context is done, except for those rejected by the server as
+// invalid, which are reported as a *StatusError. This includes a subscribe request not found,
+// e.g. due to a wrong base URL. Rate limited requests are retried no earlier
+// than requested by the server.
+func (c *Client) Next(ctx context.Context) (*Message, error) {
+	for len(c.pending) == 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		var err error
+		polling := c.id != ""
+		if polling {
+			err = c.poll(ctx)
+		} else {
+			err = c.subscribe(ctx)
+		}
+		if err != nil {
+			var wait time.Duration
+			if serr, ok := err.(*StatusError); ok {
+				wait = serr.RetryAfter
+				switch {
+				case serr.Code == http.StatusNotFound && polling:
+					// subscription expired or dropped: resubscribe from the cursor right away
+					c.id = ""
+					continue
+				case serr.Code < 500 && serr.Code != http.StatusTooManyRequests:
+					// the request itself is wrong, retrying will not help
+					return nil, err
+				}
+			}
+			if err := c.backoff(ctx, wait); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		c.retries = 0
+	}
+	msg := c.pending[0]
+	c.pending = c.pending[1:]
+	c.cursor = msg.Seq
+	return msg, nil
+}
+
+// Messages streams messages on the returned channel until the context is done, upon which the
+// channel is closed and the subscription is dropped.
+func (c *Client) Messages(ctx context.Context) <-chan *Message {
+	res := make(chan *Message)
+	go func() {
+		defer close(res)
+		defer c.Close()
+		for {
+			msg, err := c.Next(ctx)
+			if err != nil {
+				return
+			}
+			select {
+			case res <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return res
+}
+
+// Cursor returns the sequence number of the last message returned, which can be passed in
+// Options.Since to resume in a new client against the same server instance.
+func (c *Client) Cursor() uint64 {
+	return c.cursor
+}
+
+// Close drops the subscription on the server. It is safe to continue using the client afterwards,
+// in which case it subscribes anew.
+func (c *Client) Close() error {
+	if c.id == "" {
+		return nil
+	}
+	query := url.Values{"id": {c.id}}
+	c.id = ""
+	req, err := http.NewRequest(http.MethodDelete, c.baseURL+"/subscribe?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.opts.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (c *Client) subscribe(ctx context.Context) error {
+	query := url.Values{"topic": c.topics}
+	if c.opts.Timeout > 0 {
+		query.Set("timeout", c.opts.Timeout.String())
+	}
+	if c.fetched > 0 {
+		query.Set("since", strconv.FormatUint(c.fetched, 10))
+	} else if !c.latest.IsZero() {
+		// after the server went away: resume by time, see poll
+		query.Set("after", c.latest.Format(time.RFC3339Nano))
+	}
+	if c.opts.Filter != "" {
+		query.Set("filter", c.opts.Filter)
+	}
+	if len(c.opts.Fields) > 0 {
+		query.Set("fields", strings.Join(c.opts.Fields, ","))
+	}
+	for key, value := range c.opts.Labels {
+		query.Add("label", key+"="+value)
+	}
+	var res struct {
+		ID string `json:"id"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/subscribe?"+query.Encode(), &res); err != nil {
+		return err
+	}
+	c.id = res.ID
+	return nil
+}
+
+func (c *Client) poll(ctx context.Context) error {
+	query := url.Values{
+		"id":       {c.id},
+		"polltime": {c.opts.PollTime.String()},
+	}
+	if c.opts.MaxMessages > 0 {
+		query.Set("max", strconv.Itoa(c.opts.MaxMessages))
+	}
+	var res struct {
+		Messages  []*Message `json:"messages"`
+		GoingAway bool       `json:"goingAway"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/poll?"+query.Encode(), &res); err != nil {
+		return err
+	}
+	for _, msg := range res.Messages {
+		// priorities may reorder messages, resume after the latest one
+		if msg.Seq > c.fetched {
+			c.fetched = msg.Seq
+		}
+		if msg.Time.After(c.latest) {
+			c.latest = msg.Time
+		}
+	}
+	c.pending = append(c.pending, res.Messages...)
+	if res.GoingAway {
+		// the server is shutting down: subscribe anew, likely reaching another instance with
+		// unrelated sequence numbers
+		c.id = ""
+		c.fetched = 0
+	}
+	return nil
+}
+
+func (c *Client) do(ctx context.Context, method, uri string, res interface{}) error {
+	req, err := http.NewRequest(method, c.baseURL+uri, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.opts.HTTPClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var body struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&body) // best effort
+		serr := &StatusError{Code: resp.StatusCode, Msg: body.Error}
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+			serr.RetryAfter = time.Duration(secs) * time.Second
+		}
+		return serr
+	}
+	return json.NewDecoder(resp.Body).Decode(res)
+}
+
+// backoff sleeps for an exponentially growing, jittered delay, but at least for the given minimum,
+// or until the context is done.
+func (c *Client) backoff(ctx context.Context, min time.Duration) error {
+	delay := c.opts.MinBackoff
+	for i := 0; i < c.retries && delay < c.opts.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > c.opts.MaxBackoff {
+		delay = c.opts.MaxBackoff
+	}
+	c.retries++
+	// equal jitter: somewhere between half and the full delay
+	delay = delay/2 + time.Duration(c.rnd.Int63n(int64(delay/2)+1))
+	if delay < min {
+		delay = min
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
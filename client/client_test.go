@@ -0,0 +1,281 @@
+// Copyright (c) 2015-2017. Oleg Sklyar & teris.io. All rights reserved.
+// See the LICENSE file in the project root for licensing information.
+
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/teris-io/longpoll"
+	"github.com/teris-io/longpoll/client"
+)
+
+func newServer() (*longpoll.LongPoll, *httptest.Server) {
+	lp := longpoll.New()
+	lp.SetHistory(100, time.Minute)
+	mux := http.NewServeMux()
+	mux.Handle("/events/", longpoll.NewHandler(lp))
+	return lp, httptest.NewServer(mux)
+}
+
+func waitSubscribed(lp *longpoll.LongPoll) string {
+	for i := 0; i < 100; i++ {
+		if ids := lp.Ids(); len(ids) > 0 {
+			return ids[0]
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return ""
+}
+
+func TestClient_onPublish_receivesMessagesInOrder(t *testing.T) {
+	lp, srv := newServer()
+	defer srv.Close()
+	defer lp.Shutdown()
+
+	c, err := client.New(srv.URL+"/events", client.Options{PollTime: time.Second}, "A", "B")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	msgs := c.Messages(ctx)
+
+	waitSubscribed(lp)
+	lp.PublishSync(map[string]int{"value": 1}, "A")
+	lp.PublishSync(map[string]int{"value": 2}, "C")
+	lp.PublishSync(map[string]int{"value": 3}, "B")
+
+	for _, expected := range []int{1, 3} {
+		msg := <-msgs
+		var data map[string]int
+		if err := json.Unmarshal(msg.Data, &data); err != nil || data["value"] != expected {
+			t.Errorf("expected value %v, found %s", expected, msg.Data)
+		}
+	}
+	cancel()
+	if _, ok := <-msgs; ok {
+		t.Error("expected channel closed upon cancel")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if len(lp.Ids()) != 0 {
+		t.Error("expected subscription dropped upon cancel")
+	}
+}
+
+func TestClient_onSubscriptionDropped_resubscribesFromCursor(t *testing.T) {
+	lp, srv := newServer()
+	defer srv.Close()
+	defer lp.Shutdown()
+
+	c, _ := client.New(srv.URL+"/events/", client.Options{PollTime: 200 * time.Millisecond}, "A")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	go func() {
+		id := waitSubscribed(lp)
+		lp.PublishSync(1, "A")
+		time.Sleep(50 * time.Millisecond)
+		lp.Drop(id)
+		// published while no subscription exists: replayed from history
+		lp.PublishSync(2, "A")
+		lp.PublishSync(3, "A")
+	}()
+
+	for _, expected := range []string{"1", "2", "3"} {
+		msg, err := c.Next(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(msg.Data) != expected {
+			t.Errorf("expected %v, found %s", expected, msg.Data)
+		}
+		if msg.Seq != c.Cursor() {
+			t.Error("expected cursor at the last message")
+		}
+	}
+}
+
+func TestClient_onServerErrors_retriesWithBackoff(t *testing.T) {
+	lp, srv := newServer()
+	defer srv.Close()
+	defer lp.Shutdown()
+
+	target, _ := url.Parse(srv.URL)
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	var failures int32 = 3
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&failures, -1) >= 0 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		proxy.ServeHTTP(w, r)
+	}))
+	defer flaky.Close()
+
+	c, _ := client.New(flaky.URL+"/events", client.Options{
+		PollTime:   time.Second,
+		MinBackoff: 10 * time.Millisecond,
+		MaxBackoff: 40 * time.Millisecond,
+	}, "A")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	go func() {
+		waitSubscribed(lp)
+		lp.PublishSync("x", "A")
+	}()
+	start := time.Now()
+	msg, err := c.Next(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(msg.Data) != `"x"` {
+		t.Errorf("unexpected data %s", msg.Data)
+	}
+	// 5+10+20 ms at least half of it with jitter
+	if time.Now().Sub(start) < 17*time.Millisecond {
+		t.Error("expected backoff between retries")
+	}
+}
+
+func TestClient_onBadRequest_error(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error": "bad"}`, http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	c, _ := client.New(srv.URL, client.Options{}, "A")
+	_, err := c.Next(context.Background())
+	if serr, ok := err.(*client.StatusError); !ok || serr.Code != http.StatusBadRequest || serr.Msg != "bad" {
+		t.Errorf("expected bad request, found %v", err)
+	}
+}
+
+func TestClient_onSubscribeNotFound_errorWithoutRetrying(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	c, _ := client.New(srv.URL+"/wrong", client.Options{}, "A")
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	_, err := c.Next(ctx)
+	if serr, ok := err.(*client.StatusError); !ok || serr.Code != http.StatusNotFound {
+		t.Errorf("expected not found, found %v", err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("expected a single request, found %d", n)
+	}
+}
+
+func TestClient_onNoTopics_error(t *testing.T) {
+	if _, err := client.New("http://localhost", client.Options{}); err == nil {
+		t.Error("error expected")
+	}
+}
+
+func TestClient_onTooManyRequests_waitsRetryAfter(t *testing.T) {
+	lp, srv := newServer()
+	defer srv.Close()
+	defer lp.Close()
+
+	target, _ := url.Parse(srv.URL)
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	var limited int32 = 1
+	limiting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&limited, -1) >= 0 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		proxy.ServeHTTP(w, r)
+	}))
+	defer limiting.Close()
+
+	c, _ := client.New(limiting.URL+"/events", client.Options{
+		PollTime:   time.Second,
+		MinBackoff: 10 * time.Millisecond,
+	}, "A")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	go func() {
+		waitSubscribed(lp)
+		lp.PublishSync("x", "A")
+	}()
+	start := time.Now()
+	if _, err := c.Next(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if time.Now().Sub(start) < time.Second {
+		t.Error("expected retry after the requested delay")
+	}
+}
+
+func TestClient_onGoingAway_resubscribesAfterTimeOfLastMessage(t *testing.T) {
+	lp1, srv1 := newServer()
+	defer srv1.Close()
+	defer lp1.Close()
+	lp2, srv2 := newServer()
+	defer srv2.Close()
+	defer lp2.Close()
+
+	var moved int32
+	var queries []url.Values
+	var mx sync.Mutex
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			mx.Lock()
+			queries = append(queries, r.URL.Query())
+			mx.Unlock()
+		}
+		target, _ := url.Parse(srv1.URL)
+		if atomic.LoadInt32(&moved) == 1 {
+			target, _ = url.Parse(srv2.URL)
+		}
+		httputil.NewSingleHostReverseProxy(target).ServeHTTP(w, r)
+	}))
+	defer proxy.Close()
+
+	c, _ := client.New(proxy.URL+"/events", client.Options{PollTime: time.Second, MinBackoff: 10 * time.Millisecond}, "A")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	lp2.PublishSync("missed before", "A")
+	time.Sleep(10 * time.Millisecond)
+	go func() {
+		waitSubscribed(lp1)
+		lp1.PublishSync(1, "A")
+		time.Sleep(50 * time.Millisecond)
+		atomic.StoreInt32(&moved, 1)
+		lp1.ShutdownContext(ctx)
+	}()
+	if msg, err := c.Next(ctx); err != nil || string(msg.Data) != "1" {
+		t.Fatalf("unexpected message %v, %v", msg, err)
+	}
+	go func() {
+		waitSubscribed(lp2)
+		lp2.PublishSync(2, "A")
+	}()
+	if msg, err := c.Next(ctx); err != nil || string(msg.Data) != "2" {
+		t.Fatalf("expected resuming after the last message on another instance, found %v, %v", msg, err)
+	}
+	mx.Lock()
+	defer mx.Unlock()
+	if last := queries[len(queries)-1]; last.Get("since") != "" || last.Get("after") == "" {
+		t.Errorf("expected resubscribing by time, found %v", last)
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright (c) 2015-2017. Oleg Sklyar & teris.io. All rights reserved.
+// See the LICENSE file in the project root for licensing information.
+
+package longpoll
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"strconv"
+	"strings"
+)
+
+// Codec encodes the responses of Handler in a particular format. The values to encode are
+// *Batch, *SubscribeResponse and *ErrorResponse. Codecs for MessagePack, CBOR and Protobuf are
+// provided in the subpackages of codec, so that their dependencies are only imported if used.
+//
+// All codecs should encode the message envelopes alike: the fields seq, topic, time and data
+// named as in the JSON encoding, with the time in the native timestamp representation of the
+// format.
+type Codec interface {
+	// ContentType returns the media type of the encoding, e.g. application/json.
+	ContentType() string
+	// Encode writes the encoding of the value.
+	Encode(w io.Writer, v interface{}) error
+}
+
+// FragmentCodec is a Codec assembling the encoding of a batch from the encodings of its messages,
+// so that the encoding of messages published with PublishOptions.Shared can be shared by all
+// responses. EncodeBatch must produce the same output as Encode given the same batch.
+type FragmentCodec interface {
+	Codec
+	// EncodeMessage returns the encoding of the message envelope.
+	EncodeMessage(msg *Message) ([]byte, error)
+	// EncodeBatch writes the encoding of the batch given the encodings of its messages.
+	EncodeBatch(w io.Writer, batch *Batch, messages [][]byte) error
+}
+
+// SubscribeResponse is the response of Handler to a successful subscription.
+type SubscribeResponse struct {
+	ID string `json:"id"`
+}
+
+// ErrorResponse is the response of Handler to a failed request.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// JSONCodec encodes values with encoding/json. It is the default codec of Handler.
+type JSONCodec struct{}
+
+// ContentType returns application/json.
+func (JSONCodec) ContentType() string {
+	return "application/json"
+}
+
+// Encode writes the JSON encoding of the value.
+func (JSONCodec) Encode(w io.Writer, v interface{}) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+// EncodeMessage returns the JSON encoding of the message.
+func (JSONCodec) EncodeMessage(msg *Message) ([]byte, error) {
+	return json.Marshal(msg)
+}
+
+// EncodeBatch writes the JSON encoding of the batch given the encodings of its messages.
+func (JSONCodec) EncodeBatch(w io.Writer, batch *Batch, messages [][]byte) error {
+	var buf bytes.Buffer
+	buf.WriteString(`{"messages":`)
+	if batch.Messages == nil {
+		buf.WriteString("null")
+	} else {
+		buf.WriteByte('[')
+		for i, msg := range messages {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.Write(msg)
+		}
+		buf.WriteByte(']')
+	}
+	if batch.More {
+		buf.WriteString(`,"more":true`)
+	}
+	if batch.GoingAway {
+		buf.WriteString(`,"goingAway":true`)
+	}
+	buf.WriteString("}\n")
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// encode returns the encoding of the value, assembling batches from the shared encodings of their
+// messages if supported by the codec.
+func encode(codec Codec, value interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	fc, ok := codec.(FragmentCodec)
+	batch, isbatch := value.(*Batch)
+	if !ok || !isbatch {
+		err := codec.Encode(&buf, value)
+		return buf.Bytes(), err
+	}
+	messages := make([][]byte, len(batch.Messages))
+	for i, msg := range batch.Messages {
+		var err error
+		if messages[i], err = msg.encoded(codec.ContentType(), func() ([]byte, error) {
+			return fc.EncodeMessage(msg)
+		}); err != nil {
+			return nil, err
+		}
+	}
+	err := fc.EncodeBatch(&buf, batch, messages)
+	return buf.Bytes(), err
+}
+
+// negotiate selects the codec preferred by the Accept header, the first one if the header is
+// empty, and nil if none is acceptable. Codecs listed earlier win ties.
+func negotiate(accept string, codecs []Codec) Codec {
+	if strings.TrimSpace(accept) == "" {
+		if len(codecs) > 0 {
+			return codecs[0]
+		}
+		return nil
+	}
+	var res Codec
+	best := 0.0
+	for _, codec := range codecs {
+		if q := quality(accept, codec.ContentType()); q > best {
+			res, best = codec, q
+		}
+	}
+	return res
+}
+
+// quality returns the weight given by the Accept header to the media type, taking the most
+// specific matching media range.
+func quality(accept, contentType string) float64 {
+	typ := strings.SplitN(contentType, "/", 2)[0]
+	res, specificity := 0.0, -1
+	for _, part := range strings.Split(accept, ",") {
+		mediaRange, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		var spec int
+		switch mediaRange {
+		case contentType:
+			spec = 2
+		case typ + "/*":
+			spec = 1
+		case "*/*":
+			spec = 0
+		default:
+			continue
+		}
+		if spec <= specificity {
+			continue
+		}
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				q = 0
+			}
+		}
+		res, specificity = q, spec
+	}
+	return res
+}
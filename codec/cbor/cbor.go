@@ -0,0 +1,63 @@
+// Copyright (c) 2015-2017. Oleg Sklyar & teris.io. All rights reserved.
+// See the LICENSE file in the project root for licensing information.
+
+// Package cbor provides a CBOR codec for longpoll.Handler.
+package cbor
+
+import (
+	"io"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/teris-io/longpoll"
+)
+
+var mode cbor.EncMode
+
+func init() {
+	var err error
+	mode, err = cbor.EncOptions{
+		Time:    cbor.TimeRFC3339Nano,
+		TimeTag: cbor.EncTagRequired,
+	}.EncMode()
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Codec encodes values in CBOR using the field names of their JSON encoding. Times are encoded
+// as tagged RFC 3339 strings.
+type Codec struct{}
+
+// ContentType returns application/cbor.
+func (Codec) ContentType() string {
+	return "application/cbor"
+}
+
+// Encode writes the CBOR encoding of the value.
+func (Codec) Encode(w io.Writer, v interface{}) error {
+	return mode.NewEncoder(w).Encode(v)
+}
+
+// EncodeMessage returns the CBOR encoding of the message.
+func (Codec) EncodeMessage(msg *longpoll.Message) ([]byte, error) {
+	return mode.Marshal(msg)
+}
+
+// EncodeBatch writes the CBOR encoding of the batch given the encodings of its messages.
+func (Codec) EncodeBatch(w io.Writer, batch *longpoll.Batch, messages [][]byte) error {
+	res := fragments{More: batch.More, GoingAway: batch.GoingAway}
+	if batch.Messages != nil {
+		res.Messages = make([]cbor.RawMessage, len(messages))
+		for i, m := range messages {
+			res.Messages[i] = m
+		}
+	}
+	return mode.NewEncoder(w).Encode(&res)
+}
+
+// fragments mirrors longpoll.Batch with pre-encoded messages.
+type fragments struct {
+	Messages  []cbor.RawMessage `json:"messages"`
+	More      bool              `json:"more,omitempty"`
+	GoingAway bool              `json:"goingAway,omitempty"`
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2015-2017. Oleg Sklyar & teris.io. All rights reserved.
+// See the LICENSE file in the project root for licensing information.
+
+package cbor_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/teris-io/longpoll"
+	codec "github.com/teris-io/longpoll/codec/cbor"
+)
+
+func TestCodec_onEncodeBatch_usesEnvelopeFieldNames(t *testing.T) {
+	now := time.Now().UTC()
+	batch := &longpoll.Batch{
+		Messages:  []*longpoll.Message{{Seq: 7, Topic: "A", Time: now, Data: "x"}},
+		GoingAway: true,
+	}
+	var buf bytes.Buffer
+	if err := (codec.Codec{}).Encode(&buf, batch); err != nil {
+		t.Fatal(err)
+	}
+	var res map[string]interface{}
+	if err := cbor.Unmarshal(buf.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	msgs, _ := res["messages"].([]interface{})
+	if len(msgs) != 1 || res["goingAway"] != true {
+		t.Fatalf("unexpected decoding %v", res)
+	}
+	msg := msgs[0].(map[interface{}]interface{})
+	if msg["seq"] != uint64(7) || msg["topic"] != "A" || msg["data"] != "x" {
+		t.Errorf("unexpected message %v", msg)
+	}
+	if ts, ok := msg["time"].(time.Time); !ok || !ts.Equal(now) {
+		t.Errorf("expected tagged time, found %v", msg["time"])
+	}
+}
+
+func TestCodec_onEncodeBatchFromFragments_matchesEncode(t *testing.T) {
+	now := time.Now().UTC()
+	batches := []*longpoll.Batch{
+		{},
+		{Messages: []*longpoll.Message{
+			{Seq: 1, Topic: "A", Time: now, Data: "x"},
+			{Seq: 2, Topic: "B", Time: now, Data: map[string]interface{}{"a": 1.5}},
+		}, More: true, GoingAway: true},
+	}
+	c := codec.Codec{}
+	for _, batch := range batches {
+		var expected, actual bytes.Buffer
+		if err := c.Encode(&expected, batch); err != nil {
+			t.Fatal(err)
+		}
+		var messages [][]byte
+		for _, msg := range batch.Messages {
+			m, err := c.EncodeMessage(msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			messages = append(messages, m)
+		}
+		if err := c.EncodeBatch(&actual, batch, messages); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(expected.Bytes(), actual.Bytes()) {
+			t.Errorf("expected %x, found %x", expected.Bytes(), actual.Bytes())
+		}
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2015-2017. Oleg Sklyar & teris.io. All rights reserved.
+// See the LICENSE file in the project root for licensing information.
+
+// Package msgpack provides a MessagePack codec for longpoll.Handler.
+package msgpack
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/teris-io/longpoll"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Codec encodes values in MessagePack using the field names of their JSON encoding. Times are
+// encoded with the timestamp extension type.
+type Codec struct{}
+
+// ContentType returns application/msgpack.
+func (Codec) ContentType() string {
+	return "application/msgpack"
+}
+
+// Encode writes the MessagePack encoding of the value.
+func (Codec) Encode(w io.Writer, v interface{}) error {
+	return encoder(w).Encode(v)
+}
+
+// EncodeMessage returns the MessagePack encoding of the message.
+func (Codec) EncodeMessage(msg *longpoll.Message) ([]byte, error) {
+	var buf bytes.Buffer
+	err := encoder(&buf).Encode(msg)
+	return buf.Bytes(), err
+}
+
+// EncodeBatch writes the MessagePack encoding of the batch given the encodings of its messages.
+func (Codec) EncodeBatch(w io.Writer, batch *longpoll.Batch, messages [][]byte) error {
+	res := fragments{More: batch.More, GoingAway: batch.GoingAway}
+	if batch.Messages != nil {
+		res.Messages = make([]msgpack.RawMessage, len(messages))
+		for i, m := range messages {
+			res.Messages[i] = m
+		}
+	}
+	return encoder(w).Encode(&res)
+}
+
+// fragments mirrors longpoll.Batch with pre-encoded messages.
+type fragments struct {
+	Messages  []msgpack.RawMessage `json:"messages"`
+	More      bool                 `json:"more,omitempty"`
+	GoingAway bool                 `json:"goingAway,omitempty"`
+}
+
+func encoder(w io.Writer) *msgpack.Encoder {
+	enc := msgpack.NewEncoder(w)
+	enc.SetCustomStructTag("json")
+	enc.UseCompactInts(true)
+	return enc
+}
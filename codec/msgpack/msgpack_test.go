@@ -0,0 +1,75 @@
+// Copyright (c) 2015-2017. Oleg Sklyar & teris.io. All rights reserved.
+// See the LICENSE file in the project root for licensing information.
+
+package msgpack_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/teris-io/longpoll"
+	codec "github.com/teris-io/longpoll/codec/msgpack"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestCodec_onEncodeBatch_usesEnvelopeFieldNames(t *testing.T) {
+	now := time.Now().UTC()
+	batch := &longpoll.Batch{
+		Messages: []*longpoll.Message{{Seq: 7, Topic: "A", Time: now, Data: map[string]interface{}{"x": 1}}},
+		More:     true,
+	}
+	var buf bytes.Buffer
+	if err := (codec.Codec{}).Encode(&buf, batch); err != nil {
+		t.Fatal(err)
+	}
+	var res struct {
+		Messages []struct {
+			Seq   uint64                 `msgpack:"seq"`
+			Topic string                 `msgpack:"topic"`
+			Time  time.Time              `msgpack:"time"`
+			Data  map[string]interface{} `msgpack:"data"`
+		} `msgpack:"messages"`
+		More      bool `msgpack:"more"`
+		GoingAway bool `msgpack:"goingAway"`
+	}
+	if err := msgpack.Unmarshal(buf.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	msg := res.Messages[0]
+	if len(res.Messages) != 1 || msg.Seq != 7 || msg.Topic != "A" || !msg.Time.Equal(now) || msg.Data["x"] != int8(1) || !res.More {
+		t.Errorf("unexpected decoding %+v", res)
+	}
+}
+
+func TestCodec_onEncodeBatchFromFragments_matchesEncode(t *testing.T) {
+	now := time.Now().UTC()
+	batches := []*longpoll.Batch{
+		{},
+		{Messages: []*longpoll.Message{
+			{Seq: 1, Topic: "A", Time: now, Data: "x"},
+			{Seq: 2, Topic: "B", Time: now, Data: map[string]interface{}{"a": 1.5}},
+		}, More: true, GoingAway: true},
+	}
+	c := codec.Codec{}
+	for _, batch := range batches {
+		var expected, actual bytes.Buffer
+		if err := c.Encode(&expected, batch); err != nil {
+			t.Fatal(err)
+		}
+		var messages [][]byte
+		for _, msg := range batch.Messages {
+			m, err := c.EncodeMessage(msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			messages = append(messages, m)
+		}
+		if err := c.EncodeBatch(&actual, batch, messages); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(expected.Bytes(), actual.Bytes()) {
+			t.Errorf("expected %x, found %x", expected.Bytes(), actual.Bytes())
+		}
+	}
+}
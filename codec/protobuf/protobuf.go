@@ -0,0 +1,128 @@
+// Copyright (c) 2015-2017. Oleg Sklyar & teris.io. All rights reserved.
+// See the LICENSE file in the project root for licensing information.
+
+// Package protobuf provides a Protocol Buffers codec for longpoll.Handler. The responses are
+// encoded as defined in longpoll.proto in this directory.
+package protobuf
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/teris-io/longpoll"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Codec encodes responses in the Protocol Buffers binary format. Published data implementing
+// proto.Message is packed into google.protobuf.Any as is, for clients to unpack with the types
+// registered by their generated code. Any other data is converted into a google.protobuf.Value
+// via its JSON encoding.
+type Codec struct{}
+
+// ContentType returns application/x-protobuf.
+func (Codec) ContentType() string {
+	return "application/x-protobuf"
+}
+
+// Encode writes the Protocol Buffers encoding of a *longpoll.Batch, *longpoll.SubscribeResponse
+// or *longpoll.ErrorResponse.
+func (Codec) Encode(w io.Writer, v interface{}) error {
+	var b []byte
+	switch v := v.(type) {
+	case *longpoll.Batch:
+		messages := make([][]byte, len(v.Messages))
+		for i, msg := range v.Messages {
+			var err error
+			if messages[i], err = message(msg); err != nil {
+				return err
+			}
+		}
+		return Codec{}.EncodeBatch(w, v, messages)
+	case *longpoll.SubscribeResponse:
+		b = appendBytes(b, 1, []byte(v.ID))
+	case *longpoll.ErrorResponse:
+		b = appendBytes(b, 1, []byte(v.Error))
+	default:
+		return fmt.Errorf("protobuf: unsupported value of type %T", v)
+	}
+	_, err := w.Write(b)
+	return err
+}
+
+// EncodeMessage returns the Protocol Buffers encoding of the message.
+func (Codec) EncodeMessage(msg *longpoll.Message) ([]byte, error) {
+	return message(msg)
+}
+
+// EncodeBatch writes the Protocol Buffers encoding of the batch given the encodings of its
+// messages.
+func (Codec) EncodeBatch(w io.Writer, batch *longpoll.Batch, messages [][]byte) error {
+	var b []byte
+	for _, m := range messages {
+		b = appendBytes(b, 1, m)
+	}
+	if batch.More {
+		b = protowire.AppendTag(b, 2, protowire.VarintType)
+		b = protowire.AppendVarint(b, 1)
+	}
+	if batch.GoingAway {
+		b = protowire.AppendTag(b, 3, protowire.VarintType)
+		b = protowire.AppendVarint(b, 1)
+	}
+	_, err := w.Write(b)
+	return err
+}
+
+func message(msg *longpoll.Message) ([]byte, error) {
+	var b []byte
+	if msg.Seq != 0 {
+		b = protowire.AppendTag(b, 1, protowire.VarintType)
+		b = protowire.AppendVarint(b, msg.Seq)
+	}
+	if msg.Topic != "" {
+		b = appendBytes(b, 2, []byte(msg.Topic))
+	}
+	ts, err := proto.Marshal(timestamppb.New(msg.Time))
+	if err != nil {
+		return nil, err
+	}
+	b = appendBytes(b, 3, ts)
+	data, err := pack(msg.Data)
+	if err != nil {
+		return nil, err
+	}
+	return appendBytes(b, 4, data), nil
+}
+
+// pack encodes the data as google.protobuf.Any.
+func pack(data interface{}) ([]byte, error) {
+	m, ok := data.(proto.Message)
+	if !ok {
+		bytes, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		var generic interface{}
+		if err := json.Unmarshal(bytes, &generic); err != nil {
+			return nil, err
+		}
+		if m, err = structpb.NewValue(generic); err != nil {
+			return nil, err
+		}
+	}
+	packed, err := anypb.New(m)
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(packed)
+}
+
+func appendBytes(b []byte, num protowire.Number, value []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, value)
+}
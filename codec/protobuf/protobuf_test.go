@@ -0,0 +1,131 @@
+// Copyright (c) 2015-2017. Oleg Sklyar & teris.io. All rights reserved.
+// See the LICENSE file in the project root for licensing information.
+
+package protobuf_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/teris-io/longpoll"
+	codec "github.com/teris-io/longpoll/codec/protobuf"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// fields decodes the top level fields of a message, keeping the last value of each number.
+func fields(t *testing.T, b []byte) map[protowire.Number][][]byte {
+	res := make(map[protowire.Number][][]byte)
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			t.Fatal(protowire.ParseError(n))
+		}
+		b = b[n:]
+		var value []byte
+		switch typ {
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			value, b = protowire.AppendVarint(nil, v), b[n:]
+		case protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			value, b = v, b[n:]
+		default:
+			t.Fatalf("unexpected wire type %v", typ)
+		}
+		res[num] = append(res[num], value)
+	}
+	return res
+}
+
+func TestCodec_onEncodeBatch_matchesSchema(t *testing.T) {
+	now := time.Now().UTC()
+	batch := &longpoll.Batch{
+		Messages: []*longpoll.Message{
+			{Seq: 7, Topic: "A", Time: now, Data: wrapperspb.String("proto")},
+			{Seq: 8, Topic: "B", Time: now, Data: map[string]int{"x": 1}},
+		},
+		More: true,
+	}
+	var buf bytes.Buffer
+	if err := (codec.Codec{}).Encode(&buf, batch); err != nil {
+		t.Fatal(err)
+	}
+	top := fields(t, buf.Bytes())
+	if len(top[1]) != 2 || len(top[2]) != 1 || len(top[3]) != 0 {
+		t.Fatalf("unexpected batch fields %v", top)
+	}
+
+	msg := fields(t, top[1][0])
+	if seq, _ := protowire.ConsumeVarint(msg[1][0]); seq != 7 || string(msg[2][0]) != "A" {
+		t.Errorf("unexpected envelope %v", msg)
+	}
+	var ts timestamppb.Timestamp
+	if err := proto.Unmarshal(msg[3][0], &ts); err != nil || !ts.AsTime().Equal(now) {
+		t.Errorf("unexpected time %v, %v", ts.AsTime(), err)
+	}
+	var packed anypb.Any
+	var str wrapperspb.StringValue
+	if err := proto.Unmarshal(msg[4][0], &packed); err != nil || packed.UnmarshalTo(&str) != nil || str.Value != "proto" {
+		t.Errorf("expected proto data packed as is, found %v", packed.TypeUrl)
+	}
+
+	msg = fields(t, top[1][1])
+	var value structpb.Value
+	if err := proto.Unmarshal(msg[4][0], &packed); err != nil || packed.UnmarshalTo(&value) != nil {
+		t.Fatalf("expected generic data packed as value, found %v", packed.TypeUrl)
+	}
+	if x := value.GetStructValue().GetFields()["x"].GetNumberValue(); x != 1 {
+		t.Errorf("unexpected data %v", value.String())
+	}
+}
+
+func TestCodec_onEncodeOther_supportsResponsesOnly(t *testing.T) {
+	var buf bytes.Buffer
+	if err := (codec.Codec{}).Encode(&buf, &longpoll.SubscribeResponse{ID: "abc"}); err != nil {
+		t.Fatal(err)
+	}
+	if f := fields(t, buf.Bytes()); string(f[1][0]) != "abc" {
+		t.Errorf("unexpected encoding %v", f)
+	}
+	if err := (codec.Codec{}).Encode(&buf, "other"); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestCodec_onEncodeBatchFromFragments_matchesEncode(t *testing.T) {
+	now := time.Now().UTC()
+	batches := []*longpoll.Batch{
+		{},
+		{Messages: []*longpoll.Message{
+			{Seq: 1, Topic: "A", Time: now, Data: "x"},
+			{Seq: 2, Topic: "B", Time: now, Data: map[string]interface{}{"a": 1.5}},
+		}, More: true, GoingAway: true},
+	}
+	c := codec.Codec{}
+	for _, batch := range batches {
+		var expected, actual bytes.Buffer
+		if err := c.Encode(&expected, batch); err != nil {
+			t.Fatal(err)
+		}
+		var messages [][]byte
+		for _, msg := range batch.Messages {
+			m, err := c.EncodeMessage(msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			messages = append(messages, m)
+		}
+		if err := c.EncodeBatch(&actual, batch, messages); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(expected.Bytes(), actual.Bytes()) {
+			t.Errorf("expected %x, found %x", expected.Bytes(), actual.Bytes())
+		}
+	}
+}
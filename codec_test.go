@@ -0,0 +1,87 @@
+// Copyright (c) 2015-2017. Oleg Sklyar & teris.io. All rights reserved.
+// See the LICENSE file in the project root for licensing information.
+
+package longpoll_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/teris-io/longpoll"
+)
+
+type textCodec struct{}
+
+func (textCodec) ContentType() string {
+	return "text/plain"
+}
+
+func (textCodec) Encode(w io.Writer, v interface{}) error {
+	switch v := v.(type) {
+	case *longpoll.SubscribeResponse:
+		_, err := fmt.Fprint(w, v.ID)
+		return err
+	case *longpoll.ErrorResponse:
+		_, err := fmt.Fprint(w, v.Error)
+		return err
+	}
+	return fmt.Errorf("unsupported %T", v)
+}
+
+func TestCodec_onAccept_negotiatesContentType(t *testing.T) {
+	ps := longpoll.New()
+	defer ps.Close()
+	h := longpoll.NewHandler(ps)
+	h.Codecs = append(h.Codecs, textCodec{})
+
+	for accept, expected := range map[string]string{
+		"":                                       "application/json",
+		"*/*":                                    "application/json",
+		"text/plain":                             "text/plain",
+		"text/*":                                 "text/plain",
+		"application/json;q=0.5, text/plain":     "text/plain",
+		"text/plain;q=0.1, */*;q=0.5":            "application/json",
+		"text/plain, application/json":           "application/json",
+		"text/html, application/*;q=0.2":         "application/json",
+		"application/json;q=0, text/plain;q=0.3": "text/plain",
+	} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/subscribe?topic=A", nil)
+		req.Header.Set("Accept", accept)
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != expected {
+			t.Errorf("expected %v for %q, found %v %v", expected, accept, rec.Code, rec.Header().Get("Content-Type"))
+		}
+	}
+}
+
+func TestCodec_onNothingAcceptable_notAcceptable(t *testing.T) {
+	ps := longpoll.New()
+	defer ps.Close()
+	h := longpoll.NewHandler(ps)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/subscribe?topic=A", nil)
+	req.Header.Set("Accept", "application/xml, application/json;q=0")
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotAcceptable || len(ps.Ids()) != 0 {
+		t.Errorf("expected not acceptable, found %v", rec.Code)
+	}
+}
+
+func TestCodec_onEncodingFailure_internalError(t *testing.T) {
+	ps := longpoll.New()
+	defer ps.Close()
+	h := longpoll.NewHandler(ps)
+	h.Codecs = []longpoll.Codec{textCodec{}}
+	h.MaxPollTime = 10 * time.Millisecond
+	id := ps.MustSubscribe(time.Minute, "A")
+
+	if code := serve(h, http.MethodGet, "/poll?id="+id, nil); code != http.StatusInternalServerError {
+		t.Errorf("expected internal error, found %v", code)
+	}
+}
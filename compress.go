@@ -0,0 +1,83 @@
+// Copyright (c) 2015-2017. Oleg Sklyar & teris.io. All rights reserved.
+// See the LICENSE file in the project root for licensing information.
+
+package longpoll
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Compressor compresses the responses of Handler with a content coding, see Handler.Compressors.
+// A brotli compressor is provided in the compress/brotli subpackage.
+type Compressor interface {
+	// Encoding returns the content coding as used in the Accept-Encoding header, e.g. gzip.
+	Encoding() string
+	// NewWriter returns a writer compressing into w.
+	NewWriter(w io.Writer) io.WriteCloser
+}
+
+// Gzip compresses responses with gzip at the given level, the default level if zero.
+type Gzip struct {
+	Level int
+}
+
+// Encoding returns gzip.
+func (Gzip) Encoding() string {
+	return "gzip"
+}
+
+// NewWriter returns a gzip writer, falling back to the default level if the level is invalid.
+func (c Gzip) NewWriter(w io.Writer) io.WriteCloser {
+	if c.Level != 0 {
+		if res, err := gzip.NewWriterLevel(w, c.Level); err == nil {
+			return res
+		}
+	}
+	return gzip.NewWriter(w)
+}
+
+func compress(c Compressor, body []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	cw := c.NewWriter(&buf)
+	if _, err := cw.Write(body); err != nil {
+		return nil, err
+	}
+	if err := cw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// negotiateEncoding selects the compressor preferred by the Accept-Encoding header, nil if none
+// is acceptable. Compressors listed earlier win ties.
+func negotiateEncoding(accept string, compressors []Compressor) Compressor {
+	var res Compressor
+	best := 0.0
+	for _, c := range compressors {
+		q, specific := 0.0, false
+		for _, part := range strings.Split(accept, ",") {
+			params := strings.Split(part, ";")
+			coding := strings.ToLower(strings.TrimSpace(params[0]))
+			if coding != c.Encoding() && (coding != "*" || specific) {
+				continue
+			}
+			q = 1.0
+			for _, param := range params[1:] {
+				if kv := strings.SplitN(strings.TrimSpace(param), "=", 2); len(kv) == 2 && kv[0] == "q" {
+					if q, _ = strconv.ParseFloat(kv[1], 64); q < 0 {
+						q = 0
+					}
+				}
+			}
+			specific = coding != "*"
+		}
+		if q > best {
+			res, best = c, q
+		}
+	}
+	return res
+}
@@ -0,0 +1,30 @@
+// Copyright (c) 2015-2017. Oleg Sklyar & teris.io. All rights reserved.
+// See the LICENSE file in the project root for licensing information.
+
+// Package brotli provides a brotli compressor for longpoll.Handler.
+package brotli
+
+import (
+	"io"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Compressor compresses responses with brotli at the given quality, from 0 to 11, the default
+// quality if zero.
+type Compressor struct {
+	Quality int
+}
+
+// Encoding returns br.
+func (Compressor) Encoding() string {
+	return "br"
+}
+
+// NewWriter returns a brotli writer.
+func (c Compressor) NewWriter(w io.Writer) io.WriteCloser {
+	if c.Quality == 0 {
+		return brotli.NewWriter(w)
+	}
+	return brotli.NewWriterLevel(w, c.Quality)
+}
@@ -0,0 +1,40 @@
+// Copyright (c) 2015-2017. Oleg Sklyar & teris.io. All rights reserved.
+// See the LICENSE file in the project root for licensing information.
+
+package brotli_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	br "github.com/andybalholm/brotli"
+	"github.com/teris-io/longpoll/compress/brotli"
+)
+
+func TestCompressor_onNewWriter_roundTrips(t *testing.T) {
+	c := brotli.Compressor{Quality: 4}
+	if c.Encoding() != "br" {
+		t.Errorf("unexpected encoding %q", c.Encoding())
+	}
+	body := strings.Repeat(`{"price":42.5,"symbol":"ACME"}`, 100)
+	var buf bytes.Buffer
+	w := c.NewWriter(&buf)
+	if _, err := io.WriteString(w, body); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() >= len(body) {
+		t.Errorf("expected compression, got %d of %d bytes", buf.Len(), len(body))
+	}
+	res, err := io.ReadAll(br.NewReader(&buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(res) != body {
+		t.Error("round trip mismatch")
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright (c) 2015-2017. Oleg Sklyar & teris.io. All rights reserved.
+// See the LICENSE file in the project root for licensing information.
+
+package longpoll_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/teris-io/longpoll"
+)
+
+type countingData struct {
+	Text  string
+	count *int32
+}
+
+func (d countingData) MarshalJSON() ([]byte, error) {
+	atomic.AddInt32(d.count, 1)
+	return json.Marshal(d.Text)
+}
+
+func poll(h http.Handler, id, acceptEncoding string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/poll?id="+id+"&polltime=1s", nil)
+	if acceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestJSONCodec_onEncodeBatch_matchesEncode(t *testing.T) {
+	now := time.Now().UTC()
+	batches := []*longpoll.Batch{
+		{},
+		{Messages: []*longpoll.Message{}},
+		{Messages: []*longpoll.Message{{Seq: 1, Topic: "A", Time: now, Data: "x"}}, More: true},
+		{Messages: []*longpoll.Message{{Seq: 2, Topic: "A", Time: now, Data: map[string]int{"a": 1}},
+			{Seq: 3, Topic: "B", Time: now}}, GoingAway: true},
+	}
+	codec := longpoll.JSONCodec{}
+	for _, batch := range batches {
+		var expected, actual bytes.Buffer
+		if err := codec.Encode(&expected, batch); err != nil {
+			t.Fatal(err)
+		}
+		var messages [][]byte
+		for _, msg := range batch.Messages {
+			data, err := codec.EncodeMessage(msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			messages = append(messages, data)
+		}
+		if err := codec.EncodeBatch(&actual, batch, messages); err != nil {
+			t.Fatal(err)
+		}
+		if expected.String() != actual.String() {
+			t.Errorf("expected %s, found %s", expected.String(), actual.String())
+		}
+	}
+}
+
+func TestHandler_onAcceptEncoding_compressesLargeResponses(t *testing.T) {
+	ps := longpoll.New()
+	defer ps.Close()
+	h := longpoll.NewHandler(ps)
+	h.Compressors = []longpoll.Compressor{longpoll.Gzip{}}
+	id := ps.MustSubscribe(time.Minute, "A")
+	large := strings.Repeat("x", 2048)
+
+	ps.PublishSync("small", "A")
+	rec := poll(h, id, "gzip")
+	if rec.Header().Get("Content-Encoding") != "" || !strings.Contains(rec.Body.String(), "small") {
+		t.Errorf("expected uncompressed small response, found %q", rec.Header().Get("Content-Encoding"))
+	}
+	if vary := rec.Header()["Vary"]; len(vary) != 2 || vary[1] != "Accept-Encoding" {
+		t.Errorf("expected Vary on Accept-Encoding, found %v", vary)
+	}
+
+	ps.PublishSync(large, "A")
+	rec = poll(h, id, "br, gzip;q=0.5")
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("expected gzip, found %q", rec.Header().Get("Content-Encoding"))
+	}
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var batch struct {
+		Messages []struct{ Data string }
+	}
+	if err := json.NewDecoder(zr).Decode(&batch); err != nil {
+		t.Fatal(err)
+	}
+	if len(batch.Messages) != 1 || batch.Messages[0].Data != large {
+		t.Errorf("unexpected batch %v", batch)
+	}
+
+	ps.PublishSync(large, "A")
+	rec = poll(h, id, "gzip;q=0")
+	if rec.Header().Get("Content-Encoding") != "" {
+		t.Errorf("expected no compression, found %q", rec.Header().Get("Content-Encoding"))
+	}
+}
+
+func TestHandler_onSharedMessage_encodesOnce(t *testing.T) {
+	ps := longpoll.New()
+	defer ps.Close()
+	h := longpoll.NewHandler(ps)
+	h.Compressors = []longpoll.Compressor{longpoll.Gzip{}}
+	h.MinCompressSize = 1
+	var ids []string
+	for i := 0; i < 5; i++ {
+		ids = append(ids, ps.MustSubscribe(time.Minute, "A"))
+	}
+	var count int32
+	data := countingData{Text: "shared", count: &count}
+	if n, _ := ps.PublishWith(data, longpoll.PublishOptions{Shared: true}, "A"); n != 5 {
+		t.Fatalf("expected 5 receivers, found %d", n)
+	}
+
+	var bodies []string
+	for i, id := range ids {
+		encoding := "gzip"
+		if i%2 == 1 {
+			encoding = "identity"
+		}
+		rec := poll(h, id, encoding)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("unexpected status %d", rec.Code)
+		}
+		bodies = append(bodies, rec.Body.String())
+	}
+	if count != 1 {
+		t.Errorf("expected one encoding, found %d", count)
+	}
+	if bodies[0] != bodies[2] || bodies[1] != bodies[3] || !strings.Contains(bodies[1], "shared") {
+		t.Errorf("expected identical responses per encoding, found %q", bodies)
+	}
+
+	ps.PublishWith(data, longpoll.PublishOptions{}, "A")
+	for _, id := range ids {
+		poll(h, id, "")
+	}
+	if count != 6 {
+		t.Errorf("expected encoding per response if not shared, found %d", count)
+	}
+}
+
+func benchmarkFanout(b *testing.B, shared bool) {
+	ps := longpoll.New()
+	defer ps.Close()
+	h := longpoll.NewHandler(ps)
+	h.Compressors = []longpoll.Compressor{longpoll.Gzip{}}
+	var ids []string
+	for i := 0; i < 100; i++ {
+		ids = append(ids, ps.MustSubscribe(time.Minute, "A"))
+	}
+	items := make([]map[string]interface{}, 500)
+	for i := range items {
+		items[i] = map[string]interface{}{"id": i, "name": fmt.Sprintf("item %d", i), "price": float64(i) / 3}
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ps.PublishWith(items, longpoll.PublishOptions{Shared: shared}, "A")
+		for _, id := range ids {
+			rec := poll(h, id, "gzip")
+			io.Copy(io.Discard, rec.Body)
+		}
+	}
+}
+
+func BenchmarkHandler_fanoutGzip(b *testing.B) {
+	benchmarkFanout(b, false)
+}
+
+func BenchmarkHandler_fanoutGzipShared(b *testing.B) {
+	benchmarkFanout(b, true)
+}
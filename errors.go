@@ -0,0 +1,60 @@
+// Copyright (c) 2015-2017. Oleg Sklyar & teris.io. All rights reserved.
+// See the LICENSE file in the project root for licensing information.
+
+package longpoll
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// PublishError reports subscription channels that failed to accept published data. The errors
+// are keyed by the subscription channel Id.
+type PublishError struct {
+	Errors map[string]error
+}
+
+func (e *PublishError) Error() string {
+	var ids []string
+	for id := range e.Errors {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return fmt.Sprintf("publishing failed for %d subscription channel(s): %v", len(ids), ids)
+}
+
+// add records a failure for the given channel, creating the error on first use.
+func (e *PublishError) add(id string, err error) *PublishError {
+	if e == nil {
+		e = &PublishError{Errors: make(map[string]error)}
+	}
+	e.Errors[id] = err
+	return e
+}
+
+// RateLimitError reports a call rejected by a rate limit, see SetRateLimits.
+type RateLimitError struct {
+	// Op is the limited operation: subscribe, get or publish.
+	Op string
+	// Key is the key the limit applies to.
+	Key string
+	// RetryAfter is the time after which a retry is expected to succeed.
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%s rate limit exceeded for %q, retry after %v", e.Op, e.Key, e.RetryAfter)
+}
+
+// QuotaError reports a subscription rejected by a quota, see SetQuotas.
+type QuotaError struct {
+	// Quota names the exceeded quota.
+	Quota string
+	// Limit is the value of the exceeded quota.
+	Limit int
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("quota of %d %s exceeded", e.Limit, e.Quota)
+}
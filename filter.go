@@ -0,0 +1,339 @@
+// Copyright (c) 2015-2017. Oleg Sklyar & teris.io. All rights reserved.
+// See the LICENSE file in the project root for licensing information.
+
+package longpoll
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Filter decides whether a message published to a matching topic is accepted by a subscription
+// channel, see (*Channel).SetFilter. Filters are run under the channel lock and must be fast and
+// must not call methods of the channel.
+type Filter func(msg *Message) bool
+
+// ParseFilter compiles a filter expression over the message data for clients that cannot supply
+// a Go function, e.g. over HTTP. The expression compares fields of the data, addressed by dotted
+// paths into maps, JSON objects or structs in their JSON encoding, with literals, and combines
+// comparisons with boolean operators:
+//
+//	account == 'acme' and (amount >= 100 or priority == true) and not status == "closed"
+//
+// The supported comparison operators are ==, !=, <, <=, > and >=, the boolean operators are and,
+// or and not (also &&, || and !). Literals are numbers, single- or double-quoted strings, true,
+// false and null. A field on its own tests for the value true. A missing field equals null.
+// Ordering applies to numbers and strings only and is false for mismatching types. The special
+// path $topic addresses the topic of the message.
+func ParseFilter(expr string) (Filter, error) {
+	p := &parser{}
+	if err := p.lex(expr); err != nil {
+		return nil, err
+	}
+	if len(p.tokens) == 0 {
+		return nil, errors.New("empty filter expression")
+	}
+	node, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q in filter expression", p.tokens[p.pos].text)
+	}
+	return func(msg *Message) bool {
+		return node(msg, msg.document())
+	}, nil
+}
+
+type tokenKind int
+
+const (
+	tokIdent tokenKind = iota
+	tokLiteral
+	tokOp
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	kind  tokenKind
+	text  string
+	value interface{}
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+type evaluator func(msg *Message, doc interface{}) bool
+
+func (p *parser) lex(expr string) error {
+	runes := []rune(expr)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			p.tokens = append(p.tokens, token{kind: tokLParen, text: "("})
+			i++
+		case r == ')':
+			p.tokens = append(p.tokens, token{kind: tokRParen, text: ")"})
+			i++
+		case r == '\'' || r == '"':
+			j := i + 1
+			for j < len(runes) && runes[j] != r {
+				j++
+			}
+			if j == len(runes) {
+				return errors.New("unterminated string in filter expression")
+			}
+			text := string(runes[i+1 : j])
+			p.tokens = append(p.tokens, token{kind: tokLiteral, text: text, value: text})
+			i = j + 1
+		case strings.ContainsRune("=!<>&|", r):
+			j := i + 1
+			if j < len(runes) && strings.ContainsRune("=&|", runes[j]) {
+				j++
+			}
+			op := string(runes[i:j])
+			switch op {
+			case "==", "!=", "<", "<=", ">", ">=":
+			case "&&":
+				op = "and"
+			case "||":
+				op = "or"
+			case "!":
+				op = "not"
+			default:
+				return fmt.Errorf("unknown operator %q in filter expression", op)
+			}
+			p.tokens = append(p.tokens, token{kind: tokOp, text: op})
+			i = j
+		case r == '-' || r == '.' || unicode.IsDigit(r):
+			j := i + 1
+			for j < len(runes) && strings.ContainsRune("0123456789.eE+-", runes[j]) {
+				j++
+			}
+			value, err := strconv.ParseFloat(string(runes[i:j]), 64)
+			if err != nil {
+				return fmt.Errorf("invalid number %q in filter expression", string(runes[i:j]))
+			}
+			p.tokens = append(p.tokens, token{kind: tokLiteral, text: string(runes[i:j]), value: value})
+			i = j
+		case r == '$' || r == '_' || unicode.IsLetter(r):
+			j := i + 1
+			for j < len(runes) && (runes[j] == '_' || runes[j] == '.' || unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j])) {
+				j++
+			}
+			text := string(runes[i:j])
+			switch text {
+			case "and", "or", "not":
+				p.tokens = append(p.tokens, token{kind: tokOp, text: text})
+			case "true", "false":
+				p.tokens = append(p.tokens, token{kind: tokLiteral, text: text, value: text == "true"})
+			case "null":
+				p.tokens = append(p.tokens, token{kind: tokLiteral, text: text})
+			default:
+				p.tokens = append(p.tokens, token{kind: tokIdent, text: text})
+			}
+			i = j
+		default:
+			return fmt.Errorf("unexpected %q in filter expression", string(r))
+		}
+	}
+	return nil
+}
+
+func (p *parser) peek(kind tokenKind, text string) bool {
+	return p.pos < len(p.tokens) && p.tokens[p.pos].kind == kind && (text == "" || p.tokens[p.pos].text == text)
+}
+
+func (p *parser) or() (evaluator, error) {
+	left, err := p.and()
+	for err == nil && p.peek(tokOp, "or") {
+		p.pos++
+		var right evaluator
+		if right, err = p.and(); err == nil {
+			l := left
+			left = func(msg *Message, doc interface{}) bool { return l(msg, doc) || right(msg, doc) }
+		}
+	}
+	return left, err
+}
+
+func (p *parser) and() (evaluator, error) {
+	left, err := p.unary()
+	for err == nil && p.peek(tokOp, "and") {
+		p.pos++
+		var right evaluator
+		if right, err = p.unary(); err == nil {
+			l := left
+			left = func(msg *Message, doc interface{}) bool { return l(msg, doc) && right(msg, doc) }
+		}
+	}
+	return left, err
+}
+
+func (p *parser) unary() (evaluator, error) {
+	switch {
+	case p.peek(tokOp, "not"):
+		p.pos++
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(msg *Message, doc interface{}) bool { return !operand(msg, doc) }, nil
+	case p.peek(tokLParen, ""):
+		p.pos++
+		res, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if !p.peek(tokRParen, "") {
+			return nil, errors.New("missing closing parenthesis in filter expression")
+		}
+		p.pos++
+		return res, nil
+	}
+	return p.comparison()
+}
+
+func (p *parser) comparison() (evaluator, error) {
+	if !p.peek(tokIdent, "") {
+		return nil, p.unexpected("field")
+	}
+	path := p.tokens[p.pos].text
+	p.pos++
+	op, value := "==", interface{}(true)
+	if p.peek(tokOp, "") && !p.peek(tokOp, "and") && !p.peek(tokOp, "or") && !p.peek(tokOp, "not") {
+		op = p.tokens[p.pos].text
+		p.pos++
+		if !p.peek(tokLiteral, "") {
+			return nil, p.unexpected("literal")
+		}
+		value = p.tokens[p.pos].value
+		p.pos++
+	} else if p.pos < len(p.tokens) && !p.peek(tokOp, "") && !p.peek(tokRParen, "") {
+		return nil, p.unexpected("comparison operator")
+	}
+
+	var fields []string
+	if path != "$topic" {
+		fields = strings.Split(path, ".")
+	}
+	return func(msg *Message, doc interface{}) bool {
+		var field interface{} = msg.Topic
+		if fields != nil {
+			field = lookup(doc, fields)
+		}
+		return compare(field, op, value)
+	}, nil
+}
+
+func (p *parser) unexpected(expected string) error {
+	if p.pos < len(p.tokens) {
+		return fmt.Errorf("expected %s, found %q in filter expression", expected, p.tokens[p.pos].text)
+	}
+	return fmt.Errorf("expected %s at the end of filter expression", expected)
+}
+
+// document converts data into the generic form of decoded JSON for field lookup.
+func document(data interface{}) interface{} {
+	switch data := data.(type) {
+	case nil, map[string]interface{}, string, bool, float64:
+		return data
+	case json.RawMessage:
+		return unmarshalled(data)
+	case []byte:
+		return unmarshalled(data)
+	}
+	bytes, err := json.Marshal(data)
+	if err != nil {
+		return nil
+	}
+	return unmarshalled(bytes)
+}
+
+func unmarshalled(bytes []byte) interface{} {
+	var res interface{}
+	if json.Unmarshal(bytes, &res) != nil {
+		return nil
+	}
+	return res
+}
+
+func lookup(doc interface{}, fields []string) interface{} {
+	for _, field := range fields {
+		m, ok := doc.(map[string]interface{})
+		if !ok {
+			// nested data of maps constructed in Go may be of any type
+			if m, ok = document(doc).(map[string]interface{}); !ok {
+				return nil
+			}
+		}
+		doc = m[field]
+	}
+	return doc
+}
+
+func compare(field interface{}, op string, value interface{}) bool {
+	field = number(field)
+	switch op {
+	case "==":
+		return field == value
+	case "!=":
+		return field != value
+	}
+	var cmp int
+	switch f := field.(type) {
+	case float64:
+		v, ok := value.(float64)
+		if !ok {
+			return false
+		}
+		switch {
+		case f < v:
+			cmp = -1
+		case f > v:
+			cmp = 1
+		}
+	case string:
+		v, ok := value.(string)
+		if !ok {
+			return false
+		}
+		cmp = strings.Compare(f, v)
+	default:
+		return false
+	}
+	switch op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	default:
+		return cmp >= 0
+	}
+}
+
+// number converts numeric values of maps constructed in Go to float64 as decoded from JSON.
+func number(value interface{}) interface{} {
+	switch v := reflect.ValueOf(value); v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint())
+	case reflect.Float32:
+		return v.Float()
+	}
+	return value
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2015-2017. Oleg Sklyar & teris.io. All rights reserved.
+// See the LICENSE file in the project root for licensing information.
+
+package longpoll_test
+
+import (
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/teris-io/longpoll"
+)
+
+type order struct {
+	Account string  `json:"account"`
+	Amount  float64 `json:"amount"`
+	Urgent  bool    `json:"urgent"`
+	Meta    struct {
+		Region string `json:"region"`
+	} `json:"meta"`
+}
+
+func TestFilter_onParseFilter_evaluatesExpressions(t *testing.T) {
+	acme := order{Account: "acme", Amount: 150}
+	acme.Meta.Region = "eu"
+	data := []interface{}{
+		acme,
+		map[string]interface{}{"account": "acme", "amount": 50, "urgent": true},
+		json.RawMessage(`{"account": "other", "amount": 500}`),
+		"plain",
+	}
+	for expr, expected := range map[string][]bool{
+		`account == 'acme'`:                                      {true, true, false, false},
+		`account != "acme"`:                                      {false, false, true, true},
+		`amount >= 100 and amount < 200`:                         {true, false, false, false},
+		`account == 'acme' && (amount > 100 || urgent)`:          {true, true, false, false},
+		`account == 'acme' and (amount > 100 or urgent == true)`: {true, true, false, false},
+		`not account == 'acme'`:                                  {false, false, true, true},
+		`!(amount <= 50)`:                                        {true, false, true, true},
+		`meta.region == 'eu'`:                                    {true, false, false, false},
+		`missing == null`:                                        {true, true, true, true},
+		`account > 'b'`:                                          {false, false, true, false},
+		`amount > 'x'`:                                           {false, false, false, false},
+		`$topic == 'orders'`:                                     {true, true, true, true},
+		`amount == -1.5e2`:                                       {false, false, false, false},
+	} {
+		filter, err := longpoll.ParseFilter(expr)
+		if err != nil {
+			t.Errorf("unexpected error for %v: %v", expr, err)
+			continue
+		}
+		for i, d := range data {
+			if found := filter(&longpoll.Message{Topic: "orders", Data: d}); found != expected[i] {
+				t.Errorf("expected %v for %v on %v, found %v", expected[i], expr, d, found)
+			}
+		}
+	}
+}
+
+func TestFilter_onParseFilter_invalidExpressions_error(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"account 'acme'",
+		"account ==",
+		"account = 'acme'",
+		"'acme' == account",
+		"account == 'acme",
+		"(account == 'acme'",
+		"account == 'acme')",
+		"account == 'acme' and",
+		"amount == 1.2.3",
+		"account == acme",
+		"account == 'acme' # comment",
+	} {
+		if _, err := longpoll.ParseFilter(expr); err == nil {
+			t.Errorf("expected error for %q", expr)
+		}
+	}
+}
+
+type counted struct {
+	encoded *int32
+}
+
+func (c counted) MarshalJSON() ([]byte, error) {
+	atomic.AddInt32(c.encoded, 1)
+	return []byte(`{"account": "acme"}`), nil
+}
+
+func TestFilter_onFanOut_decodesDataOnce(t *testing.T) {
+	ps := longpoll.New()
+	defer ps.Close()
+	filter, _ := longpoll.ParseFilter(`account == 'acme'`)
+	for i := 0; i < 10; i++ {
+		ps.SubscribeWith(time.Minute, longpoll.SubscribeOptions{Filter: filter}, "A")
+	}
+	var encoded int32
+	if n, _ := ps.PublishSync(counted{encoded: &encoded}, "A"); n != 10 {
+		t.Errorf("expected data accepted by all filters, found %v", n)
+	}
+	if encoded != 1 {
+		t.Errorf("expected data encoded once for all filters, found %v", encoded)
+	}
+}
@@ -0,0 +1,16 @@
+module github.com/teris-io/longpoll
+
+go 1.23
+
+require (
+	github.com/andybalholm/brotli v1.2.0
+	github.com/fxamacker/cbor/v2 v2.9.2
+	github.com/teris-io/shortid v0.0.0-20220617161101-71ec9f2aa569
+	github.com/vmihailenco/msgpack/v5 v5.4.1
+	google.golang.org/protobuf v1.36.9
+)
+
+require (
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
+	github.com/x448/float16 v0.8.4 // indirect
+)
@@ -0,0 +1,357 @@
+// Copyright (c) 2015-2017. Oleg Sklyar & teris.io. All rights reserved.
+// See the LICENSE file in the project root for licensing information.
+
+package longpoll
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Handler serves a LongPoll over HTTP with responses encoded in JSON, or in another format
+// negotiated via the Accept header, see Codecs, and optionally compressed as negotiated via the
+// Accept-Encoding header, see Compressors. The handler can be mounted under any prefix and
+// dispatches on the last element of the request path:
+//
+//	POST   {prefix}/subscribe?topic=A&topic=B[&timeout=1m][&since=seq][&after=time][&filter=expr]
+//	                      [&fields=a,b.c][&label=key=value]   -> {"id": "..."}
+//	DELETE {prefix}/subscribe?id=...                                    -> 204
+//	GET    {prefix}/poll?id=...[&polltime=30s][&max=n][&maxbytes=n][&linger=d]
+//	                                                  -> {"messages": [...], "more": true}
+//
+// Errors are reported with a matching status code and a {"error": "..."} body. Requests rejected
+// by a rate limit result in 429 Too Many Requests with a Retry-After header, subscriptions
+// rejected by a quota in 403 Forbidden, requests accepting none of the codecs in 406 Not
+// Acceptable. An unknown or expired subscription Id results in 404 Not Found, upon which clients
+// are expected to subscribe anew, resuming from the sequence number of the last received message.
+// A response flagged with "goingAway" during a graceful shutdown, see (*LongPoll).ShutdownContext,
+// asks clients to subscribe anew as well, likely reaching another instance, whose sequence numbers
+// are unrelated: they are expected to resume after the time of the last received message instead,
+// given in RFC 3339 format.
+type Handler struct {
+	lp *LongPoll
+	// Timeout is the subscription timeout used if the client does not request one.
+	Timeout time.Duration
+	// PollTime is the long-polling interval used if the client does not request one.
+	PollTime time.Duration
+	// MaxPollTime caps the long-polling interval requested by the client.
+	MaxPollTime time.Duration
+	// Principal identifies the client of a request, recorded as the owner of its subscriptions
+	// and used as the key for rate limiting, see SetRateLimits. Subscriptions with an owner can
+	// only be polled and unsubscribed by it, others receive 404 Not Found. The remote IP address
+	// by default.
+	Principal func(r *http.Request) string
+	// Labels determines the labels of the subscriptions of a request, e.g. the tenant of the
+	// authenticated user, taking precedence over the labels requested by the client in the label
+	// parameters. None by default.
+	Labels func(r *http.Request) map[string]string
+	// Codecs encode the responses, selected by the Accept header of the request. Codecs listed
+	// earlier are preferred, the first one is used if the request accepts any. JSON by default.
+	Codecs []Codec
+	// Compressors compress the responses, selected by the Accept-Encoding header of the request.
+	// Compressors listed earlier are preferred. No compression by default.
+	Compressors []Compressor
+	// MinCompressSize is the minimum size of a response to be compressed, 1KiB by default.
+	MinCompressSize int
+}
+
+// NewHandler creates an HTTP handler for the given LongPoll with default timeouts.
+func NewHandler(lp *LongPoll) *Handler {
+	return &Handler{
+		lp:              lp,
+		Timeout:         time.Minute,
+		PollTime:        30 * time.Second,
+		MaxPollTime:     2 * time.Minute,
+		Principal:       RemoteIP,
+		Codecs:          []Codec{JSONCodec{}},
+		MinCompressSize: 1024,
+	}
+}
+
+// encoder pairs the response writer with the codec and the compressor negotiated for the request.
+type encoder struct {
+	http.ResponseWriter
+	codec      Codec
+	compressor Compressor
+	minsize    int
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Vary", "Accept")
+	if len(h.Compressors) > 0 {
+		w.Header().Add("Vary", "Accept-Encoding")
+	}
+	codecs := h.Codecs
+	if len(codecs) == 0 {
+		codecs = []Codec{JSONCodec{}}
+	}
+	codec := negotiate(r.Header.Get("Accept"), codecs)
+	if codec == nil {
+		writeError(w, http.StatusNotAcceptable, "no acceptable content type")
+		return
+	}
+	w = &encoder{
+		ResponseWriter: w,
+		codec:          codec,
+		compressor:     negotiateEncoding(r.Header.Get("Accept-Encoding"), h.Compressors),
+		minsize:        h.MinCompressSize,
+	}
+	switch path.Base(r.URL.Path) {
+	case "subscribe":
+		switch r.Method {
+		case http.MethodPost:
+			h.subscribe(w, r)
+		case http.MethodDelete:
+			h.unsubscribe(w, r)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	case "poll":
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		h.poll(w, r)
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (h *Handler) subscribe(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	timeout, err := durationParam(query.Get("timeout"), h.Timeout)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var opts SubscribeOptions
+	if opts.SinceSeq, err = uintParam(query.Get("since")); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if opts.SinceTime, err = timeParam(query.Get("after")); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if filter := query.Get("filter"); filter != "" {
+		if opts.Filter, err = ParseFilter(filter); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if fields := query.Get("fields"); fields != "" {
+		opts.Transform = Project(strings.Split(fields, ",")...)
+	}
+	for _, label := range query["label"] {
+		kv := strings.SplitN(label, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			writeError(w, http.StatusBadRequest, "label must be of the form key=value")
+			return
+		}
+		if opts.Labels == nil {
+			opts.Labels = make(map[string]string)
+		}
+		opts.Labels[kv[0]] = kv[1]
+	}
+	if h.Labels != nil {
+		for key, value := range h.Labels(r) {
+			if opts.Labels == nil {
+				opts.Labels = make(map[string]string)
+			}
+			opts.Labels[key] = value
+		}
+	}
+	if h.Principal != nil {
+		opts.Owner = h.Principal(r)
+	}
+	if !h.lp.isAccepting() {
+		writeError(w, http.StatusServiceUnavailable, "pubsub is down")
+		return
+	}
+	id, err := h.lp.SubscribeWith(timeout, opts, query["topic"]...)
+	switch err := err.(type) {
+	case nil:
+	case *RateLimitError:
+		writeLimited(w, err)
+		return
+	case *QuotaError:
+		writeError(w, http.StatusForbidden, err.Error())
+		return
+	default:
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	write(w, http.StatusOK, &SubscribeResponse{ID: id})
+}
+
+func (h *Handler) unsubscribe(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if ch, ok := h.lp.Channel(id); ok && !h.owns(r, ch) {
+		writeError(w, http.StatusNotFound, "no such subscription")
+		return
+	}
+	h.lp.Drop(id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// owns tests if the client of the request owns the subscription channel, or if the channel has no
+// owner, e.g. when subscribed in code, see Principal.
+func (h *Handler) owns(r *http.Request, ch *Channel) bool {
+	owner := ch.Owner()
+	return h.Principal == nil || owner == "" || h.Principal(r) == owner
+}
+
+func (h *Handler) poll(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	polltime, err := durationParam(query.Get("polltime"), h.PollTime)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if h.MaxPollTime > 0 && polltime > h.MaxPollTime {
+		polltime = h.MaxPollTime
+	}
+	var opts GetOptions
+	if opts.MaxMessages, err = intParam(query.Get("max")); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if opts.MaxBytes, err = intParam(query.Get("maxbytes")); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if opts.Linger, err = durationParam(query.Get("linger"), 0); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !h.lp.IsAlive() {
+		writeError(w, http.StatusServiceUnavailable, "pubsub is down")
+		return
+	}
+	ch, ok := h.lp.Channel(query.Get("id"))
+	if !ok || !h.owns(r, ch) {
+		writeError(w, http.StatusNotFound, "no such subscription")
+		return
+	}
+	if err := h.lp.allowGet(ch); err != nil {
+		writeLimited(w, err.(*RateLimitError))
+		return
+	}
+	batchch, err := ch.PollContext(r.Context(), polltime, opts)
+	if err != nil {
+		// dropped concurrently or a bad polltime
+		if !ch.IsAlive() {
+			writeError(w, http.StatusNotFound, "no such subscription")
+		} else {
+			writeError(w, http.StatusBadRequest, err.Error())
+		}
+		return
+	}
+	// returns promptly when the client has gone, see PollContext
+	batch := <-batchch
+	if r.Context().Err() != nil {
+		// normally empty, but data taken concurrently with the cancellation must not be lost
+		ch.restore(batch)
+		return
+	}
+	write(w, http.StatusOK, batch)
+}
+
+// write encodes the value with the codec negotiated for the request, in JSON by default, and
+// compresses it with the negotiated compressor if not shorter than the minimum size.
+func write(w http.ResponseWriter, status int, value interface{}) {
+	enc, ok := w.(*encoder)
+	if !ok {
+		enc = &encoder{ResponseWriter: w, codec: JSONCodec{}}
+	}
+	body, compressed, err := enc.body(value)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", enc.codec.ContentType())
+	w.Header().Set("Cache-Control", "no-store")
+	if compressed {
+		w.Header().Set("Content-Encoding", enc.compressor.Encoding())
+	}
+	w.WriteHeader(status)
+	w.Write(body) // errors ignored: the client has gone
+}
+
+// body returns the encoded and possibly compressed response. A response consisting of a single
+// shared message is the same for all subscribers and is cached with the message, compressed or not.
+func (enc *encoder) body(value interface{}) ([]byte, bool, error) {
+	cached := func(key string, encode func() ([]byte, error)) ([]byte, error) {
+		return encode()
+	}
+	if batch, ok := value.(*Batch); ok && len(batch.Messages) == 1 && !batch.More && !batch.GoingAway {
+		cached = batch.Messages[0].encoded
+	}
+	key := enc.codec.ContentType() + ";batch"
+	body, err := cached(key, func() ([]byte, error) {
+		return encode(enc.codec, value)
+	})
+	if err != nil || enc.compressor == nil || len(body) < enc.minsize {
+		return body, false, err
+	}
+	body, err = cached(key+";"+enc.compressor.Encoding(), func() ([]byte, error) {
+		return compress(enc.compressor, body)
+	})
+	return body, err == nil, err
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	write(w, status, &ErrorResponse{Error: msg})
+}
+
+func writeLimited(w http.ResponseWriter, err *RateLimitError) {
+	// rounded up to whole seconds as required by the header
+	secs := int64(math.Ceil(err.RetryAfter.Seconds()))
+	if secs < 1 {
+		secs = 1
+	}
+	w.Header().Set("Retry-After", strconv.FormatInt(secs, 10))
+	writeError(w, http.StatusTooManyRequests, err.Error())
+}
+
+// RemoteIP returns the IP address of the client of the request, without considering any proxy
+// headers, as these can be forged unless set by a trusted proxy.
+func RemoteIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+func durationParam(value string, def time.Duration) (time.Duration, error) {
+	if value == "" {
+		return def, nil
+	}
+	return time.ParseDuration(value)
+}
+
+func intParam(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(value)
+}
+
+func uintParam(value string) (uint64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.ParseUint(value, 10, 64)
+}
+
+func timeParam(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339Nano, value)
+}
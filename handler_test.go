@@ -0,0 +1,262 @@
+// Copyright (c) 2015-2017. Oleg Sklyar & teris.io. All rights reserved.
+// See the LICENSE file in the project root for licensing information.
+
+package longpoll_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/teris-io/longpoll"
+)
+
+func serve(h http.Handler, method, uri string, res interface{}) int {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, uri, nil))
+	if res != nil {
+		json.NewDecoder(rec.Body).Decode(res)
+	}
+	return rec.Code
+}
+
+func TestHandler_onSubscribeAndPoll_success(t *testing.T) {
+	ps := longpoll.New()
+	defer ps.Shutdown()
+	h := longpoll.NewHandler(ps)
+
+	var sub struct{ ID string }
+	if code := serve(h, http.MethodPost, "/events/subscribe?topic=A&topic=B&timeout=1m", &sub); code != http.StatusOK {
+		t.Fatalf("unexpected status %v", code)
+	}
+	if _, ok := ps.Channel(sub.ID); !ok {
+		t.Fatal("expected subscription channel")
+	}
+	ps.PublishSync("a", "A")
+	ps.PublishSync("b", "B")
+
+	var batch struct {
+		Messages []longpoll.Message
+		More     bool
+	}
+	if code := serve(h, http.MethodGet, "/events/poll?id="+sub.ID+"&polltime=1s&max=1", &batch); code != http.StatusOK {
+		t.Fatalf("unexpected status %v", code)
+	}
+	if len(batch.Messages) != 1 || batch.Messages[0].Data != "a" || batch.Messages[0].Topic != "A" || !batch.More {
+		t.Errorf("unexpected batch %v", batch)
+	}
+	batch.More = false
+	serve(h, http.MethodGet, "/events/poll?id="+sub.ID, &batch)
+	if len(batch.Messages) != 1 || batch.Messages[0].Data != "b" || batch.More {
+		t.Errorf("unexpected batch %v", batch)
+	}
+
+	if code := serve(h, http.MethodDelete, "/events/subscribe?id="+sub.ID, nil); code != http.StatusNoContent {
+		t.Errorf("unexpected status %v", code)
+	}
+	var res struct{ Error string }
+	if code := serve(h, http.MethodGet, "/events/poll?id="+sub.ID, &res); code != http.StatusNotFound || res.Error == "" {
+		t.Errorf("expected not found for dropped subscription, found %v", code)
+	}
+}
+
+func TestHandler_onPoll_withoutData_returnsEmptyAfterPolltime(t *testing.T) {
+	ps := longpoll.New()
+	defer ps.Shutdown()
+	h := longpoll.NewHandler(ps)
+	h.MaxPollTime = 100 * time.Millisecond
+
+	id := ps.MustSubscribe(time.Minute, "A")
+	start := time.Now()
+	var batch struct{ Messages []longpoll.Message }
+	if code := serve(h, http.MethodGet, "/poll?id="+id+"&polltime=1m", &batch); code != http.StatusOK {
+		t.Fatalf("unexpected status %v", code)
+	}
+	if len(batch.Messages) != 0 {
+		t.Error("unexpected messages")
+	}
+	if elapsed := time.Now().Sub(start); elapsed > 200*time.Millisecond {
+		t.Errorf("expected polltime capped, found %v", elapsed)
+	}
+}
+
+func TestHandler_onInvalidRequests_errors(t *testing.T) {
+	ps := longpoll.New()
+	h := longpoll.NewHandler(ps)
+	id := ps.MustSubscribe(time.Minute, "A")
+
+	for uri, expected := range map[string]int{
+		"/subscribe":                           http.StatusBadRequest,
+		"/subscribe?topic=A&timeout=x":         http.StatusBadRequest,
+		"/subscribe?topic=A&since=-1":          http.StatusBadRequest,
+		"/poll?id=" + id + "&max=x":            http.StatusBadRequest,
+		"/poll?id=" + id + "&polltime=-1s":     http.StatusBadRequest,
+		"/poll?id=whatever":                    http.StatusNotFound,
+		"/whatever":                            http.StatusNotFound,
+		"/poll?id=" + id + "&linger=something": http.StatusBadRequest,
+	} {
+		method := http.MethodGet
+		if strings.HasPrefix(uri, "/subscribe") {
+			method = http.MethodPost
+		}
+		if code := serve(h, method, uri, nil); code != expected {
+			t.Errorf("expected %v for %v, found %v", expected, uri, code)
+		}
+	}
+	if code := serve(h, http.MethodPut, "/subscribe", nil); code != http.StatusMethodNotAllowed {
+		t.Errorf("unexpected status %v", code)
+	}
+	ps.Shutdown()
+	if code := serve(h, http.MethodPost, "/subscribe?topic=A", nil); code != http.StatusServiceUnavailable {
+		t.Errorf("expected unavailable when down, found %v", code)
+	}
+}
+
+func TestHandler_onRateLimit_tooManyRequestsWithRetryAfter(t *testing.T) {
+	ps := longpoll.New()
+	defer ps.Close()
+	ps.SetRateLimits(longpoll.RateLimits{
+		Subscribe: longpoll.NewTokenBucket(0.5, 1),
+		Get:       longpoll.NewTokenBucket(0.5, 1),
+	})
+	h := longpoll.NewHandler(ps)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/subscribe?topic=A", nil))
+	var sub struct{ ID string }
+	json.NewDecoder(rec.Body).Decode(&sub)
+	if ch, ok := ps.Channel(sub.ID); !ok || ch.Info().Owner != "192.0.2.1" {
+		t.Fatal("expected subscription owned by the remote IP")
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/subscribe?topic=A", nil))
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "2" {
+		t.Errorf("expected subscribe limited, found %v with Retry-After %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+
+	h.MaxPollTime = 10 * time.Millisecond
+	if code := serve(h, http.MethodGet, "/poll?id="+sub.ID, nil); code != http.StatusOK {
+		t.Errorf("unexpected status %v", code)
+	}
+	if code := serve(h, http.MethodGet, "/poll?id="+sub.ID, nil); code != http.StatusTooManyRequests {
+		t.Errorf("expected poll limited, found %v", code)
+	}
+}
+
+func TestHandler_onOtherPrincipal_notFound(t *testing.T) {
+	ps := longpoll.New()
+	defer ps.Close()
+	h := longpoll.NewHandler(ps)
+	var sub struct{ ID string }
+	serve(h, http.MethodPost, "/subscribe?topic=A", &sub)
+	h.MaxPollTime = 10 * time.Millisecond
+
+	for _, method := range []string{http.MethodGet, http.MethodDelete} {
+		uri := "/poll?id=" + sub.ID
+		if method == http.MethodDelete {
+			uri = "/subscribe?id=" + sub.ID
+		}
+		req := httptest.NewRequest(method, uri, nil)
+		req.RemoteAddr = "198.51.100.1:1234"
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s: expected not found for another principal, found %v", method, rec.Code)
+		}
+	}
+	if _, ok := ps.Channel(sub.ID); !ok {
+		t.Fatal("expected subscription kept")
+	}
+	if code := serve(h, http.MethodGet, "/poll?id="+sub.ID, nil); code != http.StatusOK {
+		t.Errorf("expected the owner to poll, found %v", code)
+	}
+}
+
+func TestHandler_onQuotaExceeded_forbidden(t *testing.T) {
+	ps := longpoll.New()
+	defer ps.Close()
+	ps.SetQuotas(longpoll.Quotas{MaxPerOwner: 1})
+	h := longpoll.NewHandler(ps)
+
+	if code := serve(h, http.MethodPost, "/subscribe?topic=A", nil); code != http.StatusOK {
+		t.Errorf("unexpected status %v", code)
+	}
+	var res struct{ Error string }
+	if code := serve(h, http.MethodPost, "/subscribe?topic=A", &res); code != http.StatusForbidden || res.Error == "" {
+		t.Errorf("expected forbidden, found %v", code)
+	}
+}
+
+func TestHandler_onSubscribeWithFilter_receivesMatching(t *testing.T) {
+	ps := longpoll.New()
+	defer ps.Close()
+	h := longpoll.NewHandler(ps)
+
+	if code := serve(h, http.MethodPost, "/subscribe?topic=A&filter=account+%3D%3D", nil); code != http.StatusBadRequest {
+		t.Errorf("expected bad request for invalid filter, found %v", code)
+	}
+	var sub struct{ ID string }
+	serve(h, http.MethodPost, "/subscribe?topic=A&filter=account+%3D%3D+%27acme%27", &sub)
+	ps.PublishSync(map[string]string{"account": "other"}, "A")
+	ps.PublishSync(map[string]string{"account": "acme"}, "A")
+
+	var batch struct{ Messages []longpoll.Message }
+	serve(h, http.MethodGet, "/poll?id="+sub.ID, &batch)
+	if len(batch.Messages) != 1 || batch.Messages[0].Data.(map[string]interface{})["account"] != "acme" {
+		t.Errorf("unexpected batch %v", batch)
+	}
+}
+
+func TestHandler_onSubscribeWithFields_projects(t *testing.T) {
+	ps := longpoll.New()
+	defer ps.Close()
+	h := longpoll.NewHandler(ps)
+
+	var sub struct{ ID string }
+	serve(h, http.MethodPost, "/subscribe?topic=A&fields=id,meta.region", &sub)
+	ps.PublishSync(map[string]interface{}{"id": 1, "text": "long", "meta": map[string]string{"region": "eu"}}, "A")
+
+	var batch struct {
+		Messages []struct{ Data json.RawMessage }
+	}
+	serve(h, http.MethodGet, "/poll?id="+sub.ID, &batch)
+	if len(batch.Messages) != 1 || string(batch.Messages[0].Data) != `{"id":1,"meta":{"region":"eu"}}` {
+		t.Errorf("unexpected batch %v", batch)
+	}
+}
+
+func TestHandler_onPollClientGone_keepsDataQueued(t *testing.T) {
+	ps := longpoll.New()
+	defer ps.Close()
+	h := longpoll.NewHandler(ps)
+	id := ps.MustSubscribe(time.Minute, "A")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan bool)
+	rec := httptest.NewRecorder()
+	go func() {
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/poll?id="+id+"&polltime=1m", nil).WithContext(ctx))
+		done <- true
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected the poll to return when the client has gone")
+	}
+	if rec.Body.Len() != 0 {
+		t.Errorf("unexpected response %s", rec.Body.String())
+	}
+
+	ps.PublishSync("a", "A")
+	var batch struct{ Messages []longpoll.Message }
+	serve(h, http.MethodGet, "/poll?id="+id, &batch)
+	if len(batch.Messages) != 1 || batch.Messages[0].Data != "a" {
+		t.Errorf("expected the data for the next poll, found %v", batch)
+	}
+}
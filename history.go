@@ -0,0 +1,77 @@
+// Copyright (c) 2015-2017. Oleg Sklyar & teris.io. All rights reserved.
+// See the LICENSE file in the project root for licensing information.
+
+package longpoll
+
+import (
+	"time"
+)
+
+// history keeps the most recent messages of every topic in ring buffers limited by the number of
+// messages and, optionally, by their age. It is not synchronised and relies on the owner's lock.
+type history struct {
+	maxlen int
+	maxage time.Duration
+	topics map[string]*ring
+}
+
+type ring struct {
+	buf  []*Message
+	head int // index of the oldest message
+	size int
+}
+
+func newHistory(maxlen int, maxage time.Duration) *history {
+	return &history{
+		maxlen: maxlen,
+		maxage: maxage,
+		topics: make(map[string]*ring),
+	}
+}
+
+func (h *history) push(msg *Message) {
+	r, ok := h.topics[msg.Topic]
+	if !ok {
+		r = &ring{buf: make([]*Message, h.maxlen)}
+		h.topics[msg.Topic] = r
+	}
+	h.prune(r)
+	if r.size < len(r.buf) {
+		r.buf[(r.head+r.size)%len(r.buf)] = msg
+		r.size++
+		return
+	}
+	// full: overwrite the oldest
+	r.buf[r.head] = msg
+	r.head = (r.head + 1) % len(r.buf)
+}
+
+// messages returns the messages of the topic in the order of publishing, which satisfy the filter.
+func (h *history) messages(topic string, filter func(msg *Message) bool) []*Message {
+	r, ok := h.topics[topic]
+	if !ok {
+		return nil
+	}
+	h.prune(r)
+	var res []*Message
+	for i := 0; i < r.size; i++ {
+		msg := r.buf[(r.head+i)%len(r.buf)]
+		if filter == nil || filter(msg) {
+			res = append(res, msg)
+		}
+	}
+	return res
+}
+
+// prune removes messages that are older than the maximum age from the head of the ring.
+func (h *history) prune(r *ring) {
+	if h.maxage <= 0 {
+		return
+	}
+	oldest := time.Now().Add(-h.maxage)
+	for r.size > 0 && r.buf[r.head].Time.Before(oldest) {
+		r.buf[r.head] = nil
+		r.head = (r.head + 1) % len(r.buf)
+		r.size--
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright (c) 2015-2017. Oleg Sklyar & teris.io. All rights reserved.
+// See the LICENSE file in the project root for licensing information.
+
+package longpoll_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/teris-io/longpoll"
+)
+
+func TestHistory_onSetHistory_keepsLastMessagesPerTopic(t *testing.T) {
+	ps := longpoll.New()
+	defer ps.Shutdown()
+	if len(ps.History("A")) != 0 {
+		t.Error("no history expected when not enabled")
+	}
+	ps.SetHistory(3, 0)
+	for i := 0; i < 5; i++ {
+		ps.PublishSync(i, "A")
+	}
+	ps.PublishSync(10, "B")
+
+	hist := ps.History("A")
+	if len(hist) != 3 || hist[0].Data != 2 || hist[2].Data != 4 {
+		t.Errorf("expected 3 last messages, found %v", hist)
+	}
+	if hist[0].Seq >= hist[1].Seq || hist[1].Seq >= hist[2].Seq || hist[0].Topic != "A" {
+		t.Error("expected messages in the order of publishing")
+	}
+	if len(ps.History("B")) != 1 {
+		t.Error("expected history per topic")
+	}
+	ps.SetHistory(0, 0)
+	if len(ps.History("A")) != 0 {
+		t.Error("no history expected when disabled")
+	}
+}
+
+func TestHistory_onMaxAge_dropsOldMessages(t *testing.T) {
+	ps := longpoll.New()
+	defer ps.Shutdown()
+	ps.SetHistory(100, 100*time.Millisecond)
+	ps.Publish(1, "A")
+	time.Sleep(150 * time.Millisecond)
+	ps.Publish(2, "A")
+	hist := ps.History("A")
+	if len(hist) != 1 || hist[0].Data != 2 {
+		t.Errorf("expected old messages dropped, found %v", hist)
+	}
+}
+
+func TestHistory_onSubscribeWithSinceSeq_replaysMissedMessages(t *testing.T) {
+	ps := longpoll.New()
+	defer ps.Shutdown()
+	ps.SetHistory(10, time.Minute)
+
+	id := ps.MustSubscribe(time.Minute, "A")
+	ps.PublishSync(1, "A")
+	msgch, _ := ps.GetMessages(id, time.Second)
+	msgs := <-msgch
+	if len(msgs) != 1 || msgs[0].Data != 1 || msgs[0].Topic != "A" {
+		t.Fatalf("unexpected messages %v", msgs)
+	}
+	ps.Drop(id)
+
+	// published while the client was away
+	ps.PublishSync(2, "A")
+	ps.PublishSync(3, "B")
+	ps.PublishSync(4, "A")
+
+	id, err := ps.SubscribeWith(time.Minute, longpoll.SubscribeOptions{SinceSeq: msgs[0].Seq}, "A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	datach, _ := ps.Get(id, time.Second)
+	data := <-datach
+	if len(data) != 2 || data[0] != 2 || data[1] != 4 {
+		t.Errorf("expected missed messages replayed, found %v", data)
+	}
+}
+
+func TestHistory_onSubscribeWithSinceTime_replaysNewerMessages(t *testing.T) {
+	ps := longpoll.New()
+	defer ps.Shutdown()
+	ps.SetHistory(10, 0)
+
+	ps.PublishSync(1, "A")
+	time.Sleep(10 * time.Millisecond)
+	since := time.Now()
+	ps.PublishSync(2, "A")
+
+	id, _ := ps.SubscribeWith(time.Minute, longpoll.SubscribeOptions{SinceTime: since}, "A")
+	datach, _ := ps.Get(id, time.Second)
+	data := <-datach
+	if len(data) != 1 || data[0] != 2 {
+		t.Errorf("expected messages after given time, found %v", data)
+	}
+}
+
+func TestHistory_onReplayWithRetained_noDuplicates(t *testing.T) {
+	ps := longpoll.New()
+	defer ps.Shutdown()
+	ps.SetHistory(10, 0)
+
+	ps.PublishRetained(1, "A")
+	ps.PublishSync(2, "A")
+	ps.PublishRetained(3, "B")
+
+	id, _ := ps.SubscribeWith(time.Minute, longpoll.SubscribeOptions{SinceSeq: 1}, "A", "B")
+	datach, _ := ps.Get(id, time.Second)
+	data := <-datach
+	if len(data) != 3 || data[0] != 1 || data[1] != 2 || data[2] != 3 {
+		t.Errorf("expected history and retained values in order once, found %v", data)
+	}
+}
@@ -0,0 +1,26 @@
+// Copyright (c) 2015-2017. Oleg Sklyar & teris.io. All rights reserved.
+// See the LICENSE file in the project root for licensing information.
+
+package longpoll
+
+import "time"
+
+// ChannelInfo represents a snapshot of the state of a subscription channel, see (*Channel).Info.
+type ChannelInfo struct {
+	ID     string   `json:"id"`
+	Topics []string `json:"topics"`
+	// Owner is the principal owning the subscription if known, see SubscribeOptions.
+	Owner string `json:"owner,omitempty"`
+	// Labels are the metadata attached to the subscription, see SubscribeOptions.
+	Labels  map[string]string `json:"labels,omitempty"`
+	Created time.Time         `json:"created"`
+	// LastGet is the time of the last Get request, zero if none was made.
+	LastGet time.Time `json:"lastGet"`
+	// ExpiresIn is the time left until the channel times out unless a Get request is made.
+	ExpiresIn time.Duration `json:"expiresIn"`
+	// QueueSize and QueueBytes give the number and the total size of the queued messages.
+	QueueSize  int  `json:"queueSize"`
+	QueueBytes int  `json:"queueBytes"`
+	GetWaiting bool `json:"getWaiting"`
+	Stats
+}
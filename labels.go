@@ -0,0 +1,96 @@
+// Copyright (c) 2015-2017. Oleg Sklyar & teris.io. All rights reserved.
+// See the LICENSE file in the project root for licensing information.
+
+package longpoll
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Selector selects subscription channels by their labels, see SubscribeOptions.Labels. Selectors
+// are run for every channel on publishing and must be fast and must not modify the labels.
+type Selector func(labels map[string]string) bool
+
+// MatchLabels returns a selector accepting channels carrying all of the given labels.
+func MatchLabels(labels map[string]string) Selector {
+	required := make(map[string]string, len(labels))
+	for key, value := range labels {
+		required[key] = value
+	}
+	return func(labels map[string]string) bool {
+		for key, value := range required {
+			if actual, ok := labels[key]; !ok || actual != value {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// ParseSelector compiles a selector expression for clients that cannot supply a Go function, e.g.
+// over HTTP. The expression is a comma-separated list of requirements, all of which must hold:
+//
+//	tenant=acme,device!=ios,beta,!legacy
+//
+// A requirement key=value (or key==value) requires the label with that value, key!=value requires
+// the label to be missing or to have another value, key on its own requires the label to be
+// present and !key to be missing.
+func ParseSelector(expr string) (Selector, error) {
+	var reqs []Selector
+	for _, part := range strings.Split(expr, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			return nil, fmt.Errorf("empty requirement in selector %q", expr)
+		}
+		req, err := requirement(part)
+		if err != nil {
+			return nil, err
+		}
+		reqs = append(reqs, req)
+	}
+	return func(labels map[string]string) bool {
+		for _, req := range reqs {
+			if !req(labels) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+func requirement(part string) (Selector, error) {
+	var key, value, op string
+	switch {
+	case strings.Contains(part, "!="):
+		kv := strings.SplitN(part, "!=", 2)
+		key, value, op = kv[0], kv[1], "!="
+	case strings.Contains(part, "=="):
+		kv := strings.SplitN(part, "==", 2)
+		key, value, op = kv[0], kv[1], "="
+	case strings.Contains(part, "="):
+		kv := strings.SplitN(part, "=", 2)
+		key, value, op = kv[0], kv[1], "="
+	case strings.HasPrefix(part, "!"):
+		key, op = part[1:], "!"
+	default:
+		key, op = part, ""
+	}
+	key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+	if key == "" {
+		return nil, errors.New("missing label key in selector")
+	}
+	return func(labels map[string]string) bool {
+		actual, ok := labels[key]
+		switch op {
+		case "=":
+			return ok && actual == value
+		case "!=":
+			return !ok || actual != value
+		case "!":
+			return !ok
+		}
+		return ok
+	}, nil
+}
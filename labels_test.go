@@ -0,0 +1,165 @@
+// Copyright (c) 2015-2017. Oleg Sklyar & teris.io. All rights reserved.
+// See the LICENSE file in the project root for licensing information.
+
+package longpoll_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/teris-io/longpoll"
+)
+
+func TestParseSelector_onLabels_matches(t *testing.T) {
+	labels := map[string]string{"tenant": "acme", "device": "android", "beta": ""}
+	tests := map[string]bool{
+		"tenant=acme":                   true,
+		"tenant==acme":                  true,
+		"tenant=other":                  false,
+		"tenant = acme , device!=ios":   true,
+		"device!=android":               false,
+		"missing!=x":                    true,
+		"beta":                          true,
+		"!beta":                         false,
+		"!legacy,tenant=acme":           true,
+		"tenant=acme,device=ios":        false,
+		"tenant=acme,device=android,!x": true,
+	}
+	for expr, expected := range tests {
+		selector, err := longpoll.ParseSelector(expr)
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", expr, err)
+			continue
+		}
+		if actual := selector(labels); actual != expected {
+			t.Errorf("%q: expected %v, found %v", expr, expected, actual)
+		}
+	}
+	for _, expr := range []string{"", "tenant=acme,", "=acme", "!"} {
+		if _, err := longpoll.ParseSelector(expr); err == nil {
+			t.Errorf("%q: expected error", expr)
+		}
+	}
+}
+
+func TestMatchLabels_onLabels_requiresAll(t *testing.T) {
+	selector := longpoll.MatchLabels(map[string]string{"tenant": "acme", "app": "1.2"})
+	if !selector(map[string]string{"tenant": "acme", "app": "1.2", "device": "ios"}) {
+		t.Error("expected match")
+	}
+	if selector(map[string]string{"tenant": "acme"}) || selector(nil) {
+		t.Error("expected no match")
+	}
+}
+
+func TestLongPoll_onPublishWithSelector_deliversToSelected(t *testing.T) {
+	ps := longpoll.New()
+	defer ps.Close()
+	ps.SetHistory(10, 0)
+	acme, _ := ps.SubscribeWith(time.Minute, longpoll.SubscribeOptions{Labels: map[string]string{"tenant": "acme"}}, "A")
+	other, _ := ps.SubscribeWith(time.Minute, longpoll.SubscribeOptions{Labels: map[string]string{"tenant": "other"}}, "A")
+	plain := ps.MustSubscribe(time.Minute, "A")
+
+	selector := longpoll.MatchLabels(map[string]string{"tenant": "acme"})
+	if n, _ := ps.PublishWith("acme only", longpoll.PublishOptions{Selector: selector}, "A"); n != 1 {
+		t.Errorf("expected 1 receiver, found %d", n)
+	}
+	for id, expected := range map[string]int{acme: 1, other: 0, plain: 0} {
+		if ch, _ := ps.Channel(id); ch.QueueSize() != expected {
+			t.Errorf("%s: expected %d queued, found %d", id, expected, ch.QueueSize())
+		}
+	}
+
+	// replayed from the history only to selected subscriptions
+	opts := longpoll.SubscribeOptions{SinceSeq: 1, Labels: map[string]string{"tenant": "acme"}}
+	replayed, _ := ps.SubscribeWith(time.Minute, opts, "A")
+	opts.Labels = nil
+	skipped, _ := ps.SubscribeWith(time.Minute, opts, "A")
+	if ch, _ := ps.Channel(replayed); ch.QueueSize() != 1 {
+		t.Errorf("expected replay, found %d", ch.QueueSize())
+	}
+	if ch, _ := ps.Channel(skipped); ch.QueueSize() != 0 {
+		t.Errorf("expected no replay, found %d", ch.QueueSize())
+	}
+}
+
+func TestLongPoll_onDropWhere_dropsSelected(t *testing.T) {
+	ps := longpoll.New()
+	defer ps.Close()
+	var acme []string
+	for i := 0; i < 3; i++ {
+		id, _ := ps.SubscribeWith(time.Minute, longpoll.SubscribeOptions{Labels: map[string]string{"tenant": "acme"}}, "A")
+		acme = append(acme, id)
+	}
+	other, _ := ps.SubscribeWith(time.Minute, longpoll.SubscribeOptions{Labels: map[string]string{"tenant": "other"}}, "A")
+
+	dropped := ps.DropWhere(longpoll.MatchLabels(map[string]string{"tenant": "acme"}))
+	sort.Strings(acme)
+	sort.Strings(dropped)
+	if len(dropped) != 3 || dropped[0] != acme[0] || dropped[2] != acme[2] {
+		t.Errorf("expected %v dropped, found %v", acme, dropped)
+	}
+	if ids := ps.Ids(); len(ids) != 1 || ids[0] != other {
+		t.Errorf("expected %v left, found %v", other, ids)
+	}
+}
+
+func TestChannel_onSetLabels_copiesAndReports(t *testing.T) {
+	ch := longpoll.MustNewChannel(time.Minute, nil, "A")
+	defer ch.Drop()
+	labels := map[string]string{"user": "alice"}
+	ch.SetLabels(labels)
+	labels["user"] = "mallory"
+	ch.Labels()["user"] = "mallory"
+	if info := ch.Info(); info.Labels["user"] != "alice" {
+		t.Errorf("unexpected labels %v", info.Labels)
+	}
+}
+
+func TestHandler_onSubscribeWithLabels_labelsSubscription(t *testing.T) {
+	ps := longpoll.New()
+	defer ps.Close()
+	h := longpoll.NewHandler(ps)
+	h.Labels = func(r *http.Request) map[string]string {
+		return map[string]string{"tenant": r.Header.Get("X-Tenant")}
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/subscribe?topic=A&label=device=ios&label=tenant=forged", nil)
+	req.Header.Set("X-Tenant", "acme")
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d", rec.Code)
+	}
+	infos, _ := ps.List(nil, 0, 0)
+	if len(infos) != 1 || infos[0].Labels["device"] != "ios" || infos[0].Labels["tenant"] != "acme" {
+		t.Errorf("unexpected labels %v", infos)
+	}
+
+	if code := serve(h, http.MethodPost, "/subscribe?topic=A&label=device", nil); code != http.StatusBadRequest {
+		t.Errorf("expected bad request, found %d", code)
+	}
+}
+
+func TestAdminHandler_onListWithSelector_filters(t *testing.T) {
+	ps := longpoll.New()
+	defer ps.Close()
+	h := newAdmin(ps)
+	ps.SubscribeWith(time.Minute, longpoll.SubscribeOptions{Labels: map[string]string{"tenant": "acme"}}, "A")
+	id, _ := ps.SubscribeWith(time.Minute, longpoll.SubscribeOptions{Labels: map[string]string{"tenant": "other"}}, "A")
+
+	var list struct {
+		Subscriptions []longpoll.ChannelInfo
+		Total         int
+	}
+	serveAdmin(h, "ro", http.MethodGet, "/admin/subscriptions?selector=tenant!%3Dacme", "", &list)
+	if list.Total != 1 || list.Subscriptions[0].ID != id || list.Subscriptions[0].Labels["tenant"] != "other" {
+		t.Errorf("unexpected list %v", list)
+	}
+	if code := serveAdmin(h, "ro", http.MethodGet, "/admin/subscriptions?selector=,", "", nil); code != http.StatusBadRequest {
+		t.Errorf("expected bad request, found %d", code)
+	}
+}
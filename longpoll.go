@@ -3,15 +3,17 @@
 
 // Package longpoll provides an implementation of the long polling mechanism of the PubSub
 // pattern. Although the primary purpose of the package is to aid the development of web
-// applications, it provides no specific web handlers and can be used in other distributed
-// applications.
+// applications, it can be used in other distributed applications.
 //
 // The package provides the Channel type to manage publishing and retrieval of information for each
 // individual subscription, and the LongPoll type to manage subscription channels allowing for
-// adding, removing and publishing to all.
+// adding, removing and publishing to all. The Handler type serves a LongPoll over HTTP with
+// JSON encoding, which is consumed by the client package, and the AdminHandler serves live
+// subscription management.
 package longpoll
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"sort"
@@ -35,36 +37,157 @@ type LongPoll struct {
 	mx    sync.Mutex
 	chmap map[string]*Channel
 	alive int32
+	// set by ShutdownContext to stop accepting subscriptions and publishing while draining
+	closing int32
 	// performance optimisation: channel list cache between updates to avoid reconstructing it
 	// from chmap values and unlocking the thread ASAP. Reset to nil on any alterations to chmap
 	chcache []*Channel
+	// last published value per topic for PublishRetained, delivered to new subscriptions
+	retained map[string]*Message
+	// recent messages per topic for replay on subscribe, nil if not enabled
+	hist *history
+	// accumulated stats of closed channels
+	closed Stats
+	limits RateLimits
+	quotas Quotas
+	// system topic of presence events, empty if disabled
+	presenceTopic string
+	// name of the namespace and the namespaces within this one, see Namespace
+	name       string
+	namespaces map[string]*LongPoll
+	// held by subscribing and publishing, exclusively by bulk operations for their atomicity
+	bulk sync.RWMutex
+}
+
+// SubscribeOptions define optional properties of a subscription, see SubscribeWith.
+type SubscribeOptions struct {
+	// SinceSeq requests the replay of history messages with sequence numbers above the given one.
+	SinceSeq uint64
+	// SinceTime requests the replay of history messages published after the given time.
+	SinceTime time.Time
+	// TTL sets the default time to live of queued messages, see (*Channel).SetTTL.
+	TTL time.Duration
+	// GetMode sets the distribution of data across concurrent Get requests, see GetMode.
+	GetMode GetMode
+	// Owner records the principal owning the subscription, see (*Channel).SetOwner.
+	Owner string
+	// Filter selects the messages to receive, see (*Channel).SetFilter and ParseFilter.
+	Filter Filter
+	// Transform reshapes the data of received messages, see (*Channel).SetTransform and Project.
+	Transform Transform
+	// Labels attach arbitrary metadata to the subscription, e.g. the user, device or tenant, see
+	// (*Channel).SetLabels. Labels are used to select subscriptions, see Selector.
+	Labels map[string]string
+}
+
+func (opts SubscribeOptions) replay() bool {
+	return opts.SinceSeq > 0 || !opts.SinceTime.IsZero()
+}
+
+// isNew tests if the message was published after the replay point given by the options.
+func (opts SubscribeOptions) isNew(msg *Message) bool {
+	return msg.Seq > opts.SinceSeq && msg.Time.After(opts.SinceTime)
 }
 
 // New creates a new long-polling subscription manager.
 func New() *LongPoll {
 	return &LongPoll{
-		chmap: make(map[string]*Channel),
-		alive: yes,
+		chmap:    make(map[string]*Channel),
+		retained: make(map[string]*Message),
+		alive:    yes,
 	}
 }
 
 // Subscribe creates a new subscription channel and returns its Id (and an error if the subscription
-// channel could not be created). The subscription channel is automatically open to publishing.
+// channel could not be created). The subscription channel is automatically open to publishing and
+// receives the retained values of its topics first, see PublishRetained.
 func (lp *LongPoll) Subscribe(timeout time.Duration, topics ...string) (string, error) {
-	if !lp.IsAlive() {
+	return lp.SubscribeWith(timeout, SubscribeOptions{}, topics...)
+}
+
+// SubscribeWith acts just like Subscribe, but accepts further subscription options. If a replay is
+// requested via SinceSeq or SinceTime, the subscription channel receives the messages from the
+// topic history published after that point (see SetHistory) along with the retained values not
+// older than that point, in the order of publishing. This permits clients to resume after their
+// earlier subscription channel has expired.
+func (lp *LongPoll) SubscribeWith(timeout time.Duration, opts SubscribeOptions, topics ...string) (string, error) {
+	if !lp.isAccepting() {
 		return "", errors.New("pubsub is down")
 	}
+	if err := allow(lp.rateLimits().Subscribe, "subscribe", opts.Owner); err != nil {
+		return "", err
+	}
+	lp.mx.Lock()
+	maxTopics := lp.quotas.MaxTopics
+	lp.mx.Unlock()
+	if maxTopics > 0 && len(topics) > maxTopics {
+		return "", &QuotaError{Quota: "topics per subscription", Limit: maxTopics}
+	}
 	ch, err := NewChannel(timeout, lp.drop, topics...)
 	if err == nil {
+		lp.bulk.RLock()
+		defer lp.bulk.RUnlock()
+		ch.SetTTL(opts.TTL)
+		ch.SetGetMode(opts.GetMode)
+		ch.SetOwner(opts.Owner)
+		ch.SetLabels(opts.Labels)
+		ch.SetFilter(opts.Filter)
+		ch.SetTransform(opts.Transform)
 		lp.mx.Lock()
+		if !lp.isAccepting() {
+			// closed concurrently
+			lp.mx.Unlock()
+			ch.Drop()
+			return "", errors.New("pubsub is down")
+		}
+		// check and register under the same lock for the quotas to hold
+		evictee, err := lp.evictee(opts.Owner)
+		if err != nil {
+			lp.mx.Unlock()
+			ch.Drop()
+			return "", err
+		}
+		if evictee != nil {
+			// removed from chmap by the exit handler
+			evictee.Drop()
+		}
+		// seed under the same lock as publishing to deliver each message exactly once
+		for _, msg := range lp.seed(ch, opts) {
+			ch.publish(msg) // errors ignored
+		}
 		lp.chcache = nil
 		lp.chmap[ch.id] = ch
 		lp.mx.Unlock()
+		lp.presence(ch, PresenceSubscribe)
 		return ch.id, nil
 	}
 	return "", err
 }
 
+// seed collects retained and replayed messages for a new subscription channel.
+func (lp *LongPoll) seed(ch *Channel, opts SubscribeOptions) []*Message {
+	seen := make(map[uint64]bool)
+	var res []*Message
+	add := func(msg *Message) {
+		if !seen[msg.Seq] && (!opts.replay() || opts.isNew(msg)) {
+			seen[msg.Seq] = true
+			res = append(res, msg)
+		}
+	}
+	for _, topic := range ch.Topics() {
+		if msg, ok := lp.retained[topic]; ok {
+			add(msg)
+		}
+		if opts.replay() && lp.hist != nil {
+			for _, msg := range lp.hist.messages(topic, opts.isNew) {
+				add(msg)
+			}
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Seq < res[j].Seq })
+	return res
+}
+
 // MustSubscribe acts in the same manner as Subscribe, however, it does not return errors
 // and panics instead.
 func (lp *LongPoll) MustSubscribe(timeout time.Duration, topics ...string) string {
@@ -76,22 +199,233 @@ func (lp *LongPoll) MustSubscribe(timeout time.Duration, topics ...string) strin
 }
 
 // Publish publishes data on all subscription channels with minimal blocking. Data is published
-// separately for each topic. Closed subscription channels and mismatching topics are ignored silently.
+// separately for each topic. Mismatching topics are ignored silently. Subscription channels that
+// fail to accept the data, e.g. closed concurrently, are reported in a *PublishError.
 func (lp *LongPoll) Publish(data interface{}, topics ...string) error {
-	if !lp.IsAlive() {
+	if !lp.isAccepting() {
 		return errors.New("pubsub is down")
 	}
 	if len(topics) == 0 {
 		return errors.New("expected at least one topic")
 	}
-	for _, ch := range lp.Channels() {
-		for _, topic := range topics {
-			ch.Publish(data, topic) // errors ignored
+	if err := lp.allowPublish(topics); err != nil {
+		return err
+	}
+	lp.bulk.RLock()
+	defer lp.bulk.RUnlock()
+	msgs, chs := lp.prepare(data, PublishOptions{}, topics, false)
+	var perr *PublishError
+	for _, ch := range chs {
+		for _, msg := range msgs {
+			// enqueue under the read lock rather than in a goroutine, see DropWhere
+			if _, err := ch.publish(msg); err != nil {
+				perr = perr.add(ch.ID(), err)
+			}
 		}
 	}
+	if perr != nil {
+		return perr
+	}
 	return nil
 }
 
+// PublishSync publishes data on all subscription channels synchronously, see (*Channel).PublishSync.
+// Data published by the same publisher is received in the order of publishing. The function returns
+// the number of subscription channels that accepted the data on at least one of the topics.
+// Subscription channels that fail to accept the data are reported in a *PublishError.
+func (lp *LongPoll) PublishSync(data interface{}, topics ...string) (int, error) {
+	if !lp.isAccepting() {
+		return 0, errors.New("pubsub is down")
+	}
+	if len(topics) == 0 {
+		return 0, errors.New("expected at least one topic")
+	}
+	if err := lp.allowPublish(topics); err != nil {
+		return 0, err
+	}
+	lp.bulk.RLock()
+	defer lp.bulk.RUnlock()
+	msgs, chs := lp.prepare(data, PublishOptions{}, topics, false)
+	return publishSync(chs, msgs)
+}
+
+// PublishWith acts just like PublishSync, but accepts further message options.
+func (lp *LongPoll) PublishWith(data interface{}, opts PublishOptions, topics ...string) (int, error) {
+	if !lp.isAccepting() {
+		return 0, errors.New("pubsub is down")
+	}
+	if len(topics) == 0 {
+		return 0, errors.New("expected at least one topic")
+	}
+	if err := lp.allowPublish(topics); err != nil {
+		return 0, err
+	}
+	lp.bulk.RLock()
+	defer lp.bulk.RUnlock()
+	msgs, chs := lp.prepare(data, opts, topics, false)
+	return publishSync(chs, msgs)
+}
+
+// PublishRetained publishes data on all subscription channels synchronously (see PublishSync) and
+// retains it as the last value for each of the topics. Retained values are delivered to all
+// subscription channels created later for matching topics, before any other data.
+func (lp *LongPoll) PublishRetained(data interface{}, topics ...string) (int, error) {
+	if !lp.isAccepting() {
+		return 0, errors.New("pubsub is down")
+	}
+	if len(topics) == 0 {
+		return 0, errors.New("expected at least one topic")
+	}
+	if err := lp.allowPublish(topics); err != nil {
+		return 0, err
+	}
+	lp.bulk.RLock()
+	defer lp.bulk.RUnlock()
+	msgs, chs := lp.prepare(data, PublishOptions{}, topics, true)
+	return publishSync(chs, msgs)
+}
+
+// prepare creates a message per topic, records it in the history and retains it if requested. It
+// returns the messages along with the channels to publish them to: channels subscribing later
+// receive them on subscription instead.
+func (lp *LongPoll) prepare(data interface{}, opts PublishOptions, topics []string, retain bool) ([]*Message, []*Channel) {
+	msgs := make([]*Message, len(topics))
+	lp.mx.Lock()
+	defer lp.mx.Unlock()
+	for i, topic := range topics {
+		msg := newMessageWith(data, topic, opts)
+		if lp.hist != nil {
+			lp.hist.push(msg)
+		}
+		if retain {
+			lp.retained[topic] = msg
+		}
+		msgs[i] = msg
+	}
+	return msgs, lp.channels()
+}
+
+func publishSync(chs []*Channel, msgs []*Message) (int, error) {
+	count := 0
+	var perr *PublishError
+	for _, ch := range chs {
+		accepted := false
+		for _, msg := range msgs {
+			ok, err := ch.publish(msg)
+			if err != nil {
+				perr = perr.add(ch.ID(), err)
+				break
+			}
+			accepted = accepted || ok
+		}
+		if accepted {
+			count++
+		}
+	}
+	if perr != nil {
+		return count, perr
+	}
+	return count, nil
+}
+
+// SetQuotas sets the quotas enforced on subscribing, replacing any set earlier. Subscriptions
+// exceeding a quota are rejected with a *QuotaError unless the eviction policy permits dropping
+// an older subscription instead. Existing subscriptions are not affected by lowering the quotas.
+func (lp *LongPoll) SetQuotas(quotas Quotas) {
+	lp.mx.Lock()
+	lp.quotas = quotas
+	lp.mx.Unlock()
+}
+
+// SetRateLimits sets the limiters for subscribing, Get requests and publishing, replacing any set
+// earlier. Calls exceeding a limit are rejected with a *RateLimitError. Publishing is rejected as
+// a whole if any of the topics is limited; with a MultiLimiter, such as TokenBucket, a rejected
+// publication does not count against the limits of the other topics. Calls directly on a Channel
+// are not limited.
+func (lp *LongPoll) SetRateLimits(limits RateLimits) {
+	lp.mx.Lock()
+	lp.limits = limits
+	lp.mx.Unlock()
+}
+
+func (lp *LongPoll) rateLimits() RateLimits {
+	lp.mx.Lock()
+	defer lp.mx.Unlock()
+	return lp.limits
+}
+
+func (lp *LongPoll) allowGet(ch *Channel) error {
+	key := ch.Owner()
+	if key == "" {
+		key = ch.id
+	}
+	return allow(lp.rateLimits().Get, "get", key)
+}
+
+func (lp *LongPoll) allowPublish(topics []string) error {
+	limiter := lp.rateLimits().Publish
+	if multi, ok := limiter.(MultiLimiter); ok {
+		if ok, topic, retry := multi.AllowAll(topics); !ok {
+			return &RateLimitError{Op: "publish", Key: topic, RetryAfter: retry}
+		}
+		return nil
+	}
+	for _, topic := range topics {
+		if err := allow(limiter, "publish", topic); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetHistory enables keeping the last maxlen messages of every topic, optionally limited to those
+// not older than maxage, for replay on subscription, see SubscribeWith. Any previously kept history
+// is discarded. A non-positive maxlen disables the history.
+func (lp *LongPoll) SetHistory(maxlen int, maxage time.Duration) {
+	lp.mx.Lock()
+	defer lp.mx.Unlock()
+	if maxlen <= 0 {
+		lp.hist = nil
+		return
+	}
+	lp.hist = newHistory(maxlen, maxage)
+}
+
+// History returns the currently kept history of the topic in the order of publishing.
+func (lp *LongPoll) History(topic string) []*Message {
+	lp.mx.Lock()
+	defer lp.mx.Unlock()
+	if lp.hist == nil {
+		return nil
+	}
+	return lp.hist.messages(topic, nil)
+}
+
+// Retained returns a copy of the currently retained values by topic.
+func (lp *LongPoll) Retained() map[string]interface{} {
+	res := make(map[string]interface{})
+	lp.mx.Lock()
+	for topic, msg := range lp.retained {
+		res[topic] = msg.Data
+	}
+	lp.mx.Unlock()
+	return res
+}
+
+// ClearRetained removes retained values for the given topics, or all of them if none given.
+// Data already delivered to subscription channels is not affected.
+func (lp *LongPoll) ClearRetained(topics ...string) {
+	lp.mx.Lock()
+	defer lp.mx.Unlock()
+	if len(topics) == 0 {
+		lp.retained = make(map[string]*Message)
+		return
+	}
+	for _, topic := range topics {
+		delete(lp.retained, topic)
+	}
+}
+
 // Channel returns a pointer to the subscription channel behind the given id.
 func (lp *LongPoll) Channel(id string) (*Channel, bool) {
 	if !lp.IsAlive() {
@@ -115,7 +449,10 @@ func (lp *LongPoll) Channels() []*Channel {
 
 	lp.mx.Lock()
 	defer lp.mx.Unlock()
+	return lp.channels()
+}
 
+func (lp *LongPoll) channels() []*Channel {
 	if len(lp.chcache) == 0 { // either no data or invalidated
 		for _, ch := range lp.chmap {
 			if ch.IsAlive() {
@@ -141,6 +478,35 @@ func (lp *LongPoll) Ids() []string {
 	return res
 }
 
+// List returns the snapshots of the subscription channels accepted by the optional filter, ordered
+// by creation time, skipping offset entries and returning at most limit ones if limit is positive.
+// The total number of accepted channels is returned along with the page.
+func (lp *LongPoll) List(filter func(ChannelInfo) bool, offset, limit int) ([]ChannelInfo, int) {
+	var infos []ChannelInfo
+	for _, ch := range lp.Channels() {
+		if info := ch.Info(); ch.IsAlive() && (filter == nil || filter(info)) {
+			infos = append(infos, info)
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Created.Equal(infos[j].Created) {
+			return infos[i].ID < infos[j].ID
+		}
+		return infos[i].Created.Before(infos[j].Created)
+	})
+	total := len(infos)
+	if offset > total {
+		offset = total
+	}
+	if offset > 0 {
+		infos = infos[offset:]
+	}
+	if limit > 0 && len(infos) > limit {
+		infos = infos[:limit]
+	}
+	return infos, total
+}
+
 // Get requests data published on all of the topics for the given subscription channel.
 // See further info in (*Channel).Get.
 func (lp *LongPoll) Get(id string, polltime time.Duration) (chan []interface{}, error) {
@@ -148,11 +514,62 @@ func (lp *LongPoll) Get(id string, polltime time.Duration) (chan []interface{},
 		return nil, errors.New("pubsub is down")
 	}
 	if ch, ok := lp.Channel(id); ok {
+		if err := lp.allowGet(ch); err != nil {
+			return nil, err
+		}
 		return ch.Get(polltime)
 	}
 	return nil, fmt.Errorf("no channel for Id %v", id)
 }
 
+// GetMessages requests messages published on all of the topics for the given subscription channel.
+// See further info in (*Channel).GetMessages.
+func (lp *LongPoll) GetMessages(id string, polltime time.Duration) (chan []*Message, error) {
+	if !lp.IsAlive() {
+		return nil, errors.New("pubsub is down")
+	}
+	if ch, ok := lp.Channel(id); ok {
+		if err := lp.allowGet(ch); err != nil {
+			return nil, err
+		}
+		return ch.GetMessages(polltime)
+	}
+	return nil, fmt.Errorf("no channel for Id %v", id)
+}
+
+// Poll requests a batch of messages for the given subscription channel within the given limits.
+// See further info in (*Channel).Poll.
+func (lp *LongPoll) Poll(id string, polltime time.Duration, opts GetOptions) (chan *Batch, error) {
+	return lp.PollContext(context.Background(), id, polltime, opts)
+}
+
+// PollContext acts just like Poll, but stops waiting as soon as the context is done. See further
+// info in (*Channel).PollContext.
+func (lp *LongPoll) PollContext(ctx context.Context, id string, polltime time.Duration, opts GetOptions) (chan *Batch, error) {
+	if !lp.IsAlive() {
+		return nil, errors.New("pubsub is down")
+	}
+	if ch, ok := lp.Channel(id); ok {
+		if err := lp.allowGet(ch); err != nil {
+			return nil, err
+		}
+		return ch.PollContext(ctx, polltime, opts)
+	}
+	return nil, fmt.Errorf("no channel for Id %v", id)
+}
+
+// Stats returns the message counters accumulated over all subscription channels, including those
+// already closed, but excluding those of namespaces.
+func (lp *LongPoll) Stats() Stats {
+	lp.mx.Lock()
+	defer lp.mx.Unlock()
+	res := lp.closed
+	for _, ch := range lp.chmap {
+		res.add(ch.Stats())
+	}
+	return res
+}
+
 // IsAlive tests if the pubsub service is up and running.
 func (lp *LongPoll) IsAlive() bool {
 	return atomic.LoadInt32(&lp.alive) == yes
@@ -164,38 +581,164 @@ func (lp *LongPoll) Drop(id string) {
 	if ch, ok := lp.Channel(id); ok {
 		// channel will call lp.drop if it is alive as it was given as exit handler
 		// to be called on timeout (or any closure), however, we want to force it
-		// even if channel is no more alive for any reasons:
-		lp.drop(ch.ID())
+		// even if channel is no more alive for any reasons, once the queue has been
+		// discarded for the stats to account for it:
 		ch.Drop()
+		lp.drop(ch.ID())
 	}
 }
 
 func (lp *LongPoll) drop(id string) {
 	lp.mx.Lock()
+	ch, ok := lp.chmap[id]
+	if ok {
+		lp.closed.add(ch.Stats())
+	}
 	lp.chcache = nil
 	delete(lp.chmap, id)
 	lp.mx.Unlock()
+	if ok {
+		if ch.timedOut() {
+			lp.presence(ch, PresenceTimeout)
+		} else {
+			lp.presence(ch, PresenceDrop)
+		}
+	}
 }
 
-// Shutdown terminates the pubsub service and drops all subscription channels.
+// Shutdown terminates the pubsub service and drops all subscription channels immediately, just
+// like Close. See ShutdownContext for a graceful shutdown.
 func (lp *LongPoll) Shutdown() {
-	if !lp.IsAlive() {
-		// already down (or going down) and this here is the only method that resets the flag
-		return
+	lp.close()
+}
+
+// ShutdownContext gracefully terminates the pubsub service. It stops accepting new subscriptions
+// and publishing immediately and lets all Get requests return with whatever is queued and the
+// GoingAway flag set, telling clients to reconnect elsewhere. Subscription channels are dropped as
+// soon as their queues are drained. Once the context is done, the remaining ones are dropped
+// forcibly and the context error is returned. Namespaces are shut down alike, see Namespace.
+// ShutdownContext returns after all goroutines of the subscription channels have exited, which
+// takes place promptly once they have been dropped.
+func (lp *LongPoll) ShutdownContext(ctx context.Context) error {
+	if !lp.IsAlive() || !atomic.CompareAndSwapInt32(&lp.closing, no, yes) {
+		// already down or going down
+		return nil
+	}
+	nserr := make(chan error, 1)
+	go func() {
+		nserr <- lp.shutdownNamespaces(ctx)
+	}()
+	chs := lp.Channels()
+	for _, ch := range chs {
+		ch.goAway()
 	}
 
-	atomic.StoreInt32(&lp.alive, no)
+	var err error
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for drained := false; !drained; {
+		drained = true
+		for _, ch := range chs {
+			if !ch.IsAlive() {
+				continue
+			}
+			if ch.drained() {
+				ch.Drop()
+			} else {
+				drained = false
+			}
+		}
+		if drained {
+			break
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			err = ctx.Err()
+			drained = true
+		}
+	}
 
+	if nerr := <-nserr; err == nil {
+		err = nerr
+	}
+	// channels drained above are no longer registered, but have to be waited for as well; all of
+	// them are dropped at this point, so their goroutines exit without waiting for the context
+	chs = append(chs, lp.close()...)
+	for _, ch := range chs {
+		ch.wait()
+	}
+	return err
+}
+
+// Close terminates the pubsub service immediately and drops all subscription channels discarding
+// any queued data, including those of its namespaces. Waiting Get requests return empty.
+func (lp *LongPoll) Close() {
+	lp.close()
+}
+
+// close drops all subscription channels and returns them.
+func (lp *LongPoll) close() []*Channel {
 	lp.mx.Lock()
 	defer lp.mx.Unlock()
 
+	if !atomic.CompareAndSwapInt32(&lp.alive, yes, no) {
+		// already down
+		return nil
+	}
+
+	var res []*Channel
 	// do not use lp.Channels here as it delivers only alive ones
 	for _, ch := range lp.chmap {
 		ch.Drop()
+		lp.closed.add(ch.Stats())
+		res = append(res, ch)
 	}
+	res = append(res, lp.closeNamespaces()...)
 	// remove all subscription channels
 	lp.chmap = make(map[string]*Channel)
 	lp.chcache = nil
+	lp.retained = make(map[string]*Message)
+	if lp.hist != nil {
+		lp.hist = newHistory(lp.hist.maxlen, lp.hist.maxage)
+	}
+	return res
+}
+
+// Start brings the pubsub service back up after Shutdown, ShutdownContext or Close, so that the same instance can
+// be reused, e.g. when referenced throughout an application. The service starts without any
+// subscription channels, retained values or history, while the history settings and the stats of
+// closed channels are kept. Namespaces are started along, see Namespace. An error is returned if
+// the service is up or still shutting down.
+func (lp *LongPoll) Start() error {
+	lp.mx.Lock()
+	defer lp.mx.Unlock()
+	if lp.IsAlive() {
+		if atomic.LoadInt32(&lp.closing) == yes {
+			return errors.New("pubsub is shutting down")
+		}
+		return errors.New("pubsub is up")
+	}
+	atomic.StoreInt32(&lp.closing, no)
+	atomic.StoreInt32(&lp.alive, yes)
+	lp.startNamespaces()
+	return nil
+}
+
+// Restart gracefully shuts the pubsub service down and starts it anew, see ShutdownContext and
+// Start. The service is started even if the context is done before all subscription channels
+// drained, in which case the context error is returned.
+func (lp *LongPoll) Restart(ctx context.Context) error {
+	err := lp.ShutdownContext(ctx)
+	if serr := lp.Start(); serr != nil {
+		return serr
+	}
+	return err
+}
+
+// isAccepting tests if the pubsub service accepts new subscriptions and publishing.
+func (lp *LongPoll) isAccepting() bool {
+	return lp.IsAlive() && atomic.LoadInt32(&lp.closing) == no
 }
 
 // Topics constructs the set of all topics, for which there are currently open
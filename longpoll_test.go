@@ -4,6 +4,8 @@
 package longpoll_test
 
 import (
+	"context"
+	"errors"
 	"testing"
 	"time"
 
@@ -339,6 +341,47 @@ func TestLongPoll_onShutdown_success(t *testing.T) {
 	}
 }
 
+func TestLongPoll_onShutdown_withLongPollWaiting_honoursDeadline(t *testing.T) {
+	ps := longpoll.New()
+	id := ps.MustSubscribe(time.Hour, "A")
+	batchch, _ := ps.Poll(id, 10*time.Minute, longpoll.GetOptions{})
+	time.Sleep(10 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	ps.ShutdownContext(ctx)
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("expected shutdown within the deadline, took %v", elapsed)
+	}
+	select {
+	case batch := <-batchch:
+		if !batch.GoingAway {
+			t.Error("expected the waiting Get released going away")
+		}
+	default:
+		t.Error("expected the waiting Get served before shutdown returns")
+	}
+}
+
+func TestLongPoll_onShutdown_withDeadlinePassed_waitsForChannels(t *testing.T) {
+	ps := longpoll.New()
+	id := ps.MustSubscribe(time.Hour, "A")
+	batchch, _ := ps.Poll(id, 10*time.Minute, longpoll.GetOptions{})
+	time.Sleep(10 * time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := ps.ShutdownContext(ctx); err != context.Canceled {
+		t.Errorf("expected context error, found %v", err)
+	}
+	select {
+	case <-batchch:
+	default:
+		t.Error("expected the waiting Get served before shutdown returns")
+	}
+}
+
 func TestLongPoll_onShutdown_whenDown_ignored(t *testing.T) {
 	ps := longpoll.New()
 	ps.Shutdown()
@@ -396,3 +439,510 @@ func TestLongPoll_onTopics_uniqueAndSorted(t *testing.T) {
 		}
 	}
 }
+
+func TestLongPoll_onPublishSync_countsAcceptingChannels(t *testing.T) {
+	ps := longpoll.New()
+	defer ps.Shutdown()
+	id1 := ps.MustSubscribe(time.Minute, "A", "B")
+	id2 := ps.MustSubscribe(time.Minute, "B", "C")
+	ps.MustSubscribe(time.Minute, "D")
+
+	n, err := ps.PublishSync(make(map[string]int), "B", "C")
+	if err != nil {
+		t.Errorf("no error expected, %v", err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 accepting channels, found %v", n)
+	}
+	ch1, _ := ps.Channel(id1)
+	ch2, _ := ps.Channel(id2)
+	if ch1.QueueSize() != 1 || ch2.QueueSize() != 2 {
+		t.Error("expected data queued upon return")
+	}
+	n, _ = ps.PublishSync(make(map[string]int), "E")
+	if n != 0 {
+		t.Error("expected no accepting channels")
+	}
+}
+
+func TestLongPoll_onPublishSync_whenDownOrNoTopics_error(t *testing.T) {
+	ps := longpoll.New()
+	if _, err := ps.PublishSync(make(map[string]int)); err == nil {
+		t.Error("expected error on publish")
+	}
+	ps.Shutdown()
+	if _, err := ps.PublishSync(make(map[string]int), "A"); err == nil {
+		t.Error("expected error on publish")
+	}
+}
+
+func TestLongPoll_onPublishError_listsChannelIds(t *testing.T) {
+	err := &longpoll.PublishError{Errors: map[string]error{
+		"b": errors.New("subscription channel is down"),
+		"a": errors.New("subscription channel is down"),
+	}}
+	if err.Error() != "publishing failed for 2 subscription channel(s): [a b]" {
+		t.Errorf("unexpected error message: %v", err)
+	}
+}
+
+func TestLongPoll_onPublishRetained_deliveredToNewSubscriptions(t *testing.T) {
+	ps := longpoll.New()
+	defer ps.Shutdown()
+	id1 := ps.MustSubscribe(time.Minute, "A")
+	n, err := ps.PublishRetained("a1", "A")
+	if n != 1 || err != nil {
+		t.Errorf("expected delivery to existing subscription, %v", err)
+	}
+	ps.PublishRetained("a2", "A")
+	ps.PublishRetained("b1", "B")
+
+	id2 := ps.MustSubscribe(time.Minute, "B", "A", "C")
+	datach, _ := ps.Get(id2, time.Second)
+	data := <-datach
+	if len(data) != 2 || data[0] != "a2" || data[1] != "b1" {
+		t.Errorf("expected last retained values on subscribe, found %v", data)
+	}
+	datach, _ = ps.Get(id1, time.Second)
+	if data = <-datach; len(data) != 2 {
+		t.Errorf("expected all published values on existing subscription, found %v", data)
+	}
+}
+
+func TestLongPoll_onSubscribeWith_expiringWhileSeeded_noDeadlock(t *testing.T) {
+	ps := longpoll.New()
+	defer ps.Close()
+	ps.SetHistory(10, 0)
+	slow := func(labels map[string]string) bool {
+		// let the channel expire while the message is being seeded
+		time.Sleep(50 * time.Millisecond)
+		return true
+	}
+	ps.PublishWith("a", longpoll.PublishOptions{Selector: slow}, "A")
+
+	done := make(chan bool)
+	go func() {
+		ps.SubscribeWith(10*time.Millisecond, longpoll.SubscribeOptions{SinceTime: time.Now().Add(-time.Minute)}, "A")
+		done <- true
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected subscribing not to deadlock with the expiring channel")
+	}
+}
+
+func TestLongPoll_onClearRetained_notDelivered(t *testing.T) {
+	ps := longpoll.New()
+	defer ps.Shutdown()
+	ps.PublishRetained("a", "A")
+	ps.PublishRetained("b", "B")
+	ps.PublishRetained("c", "C")
+
+	retained := ps.Retained()
+	if len(retained) != 3 || retained["B"] != "b" {
+		t.Errorf("unexpected retained values %v", retained)
+	}
+	ps.ClearRetained("B")
+	if retained = ps.Retained(); len(retained) != 2 {
+		t.Errorf("unexpected retained values %v", retained)
+	}
+	id := ps.MustSubscribe(time.Minute, "B")
+	ch, _ := ps.Channel(id)
+	if ch.QueueSize() != 0 {
+		t.Error("expected no retained data")
+	}
+	ps.ClearRetained()
+	if len(ps.Retained()) != 0 {
+		t.Error("expected no retained values")
+	}
+}
+
+func TestLongPoll_onPublishWithTTL_expiredCountedInStats(t *testing.T) {
+	ps := longpoll.New()
+	defer ps.Shutdown()
+	id1 := ps.MustSubscribe(time.Minute, "A")
+	id2, _ := ps.SubscribeWith(time.Minute, longpoll.SubscribeOptions{TTL: 50 * time.Millisecond}, "A")
+
+	ps.PublishWith("a", longpoll.PublishOptions{TTL: 50 * time.Millisecond}, "A")
+	ps.PublishSync("b", "A")
+	time.Sleep(100 * time.Millisecond)
+
+	datach, _ := ps.Get(id1, time.Second)
+	if data := <-datach; len(data) != 1 || data[0] != "b" {
+		t.Errorf("expected message without TTL, found %v", data)
+	}
+	datach, _ = ps.Get(id2, 100*time.Millisecond)
+	if data := <-datach; len(data) != 0 {
+		t.Errorf("expected all messages expired, found %v", data)
+	}
+	if ps.Stats().Expired != 3 {
+		t.Errorf("expected 3 expired messages, found %v", ps.Stats().Expired)
+	}
+	ps.Drop(id1)
+	ps.Drop(id2)
+	if ps.Stats().Expired != 3 {
+		t.Error("expected stats of closed channels retained")
+	}
+}
+
+func TestLongPoll_onDropAndClose_queuesCountedAsDropped(t *testing.T) {
+	ps := longpoll.New()
+	id := ps.MustSubscribe(time.Minute, "A")
+	ps.MustSubscribe(time.Minute, "A", "B")
+	ps.PublishSync("a", "A")
+	ps.PublishSync("b", "B")
+
+	ps.Drop(id)
+	if dropped := ps.Stats().Dropped; dropped != 1 {
+		t.Errorf("expected 1 dropped message, found %v", dropped)
+	}
+	ps.Close()
+	if dropped := ps.Stats().Dropped; dropped != 3 {
+		t.Errorf("expected 3 dropped messages, found %v", dropped)
+	}
+}
+
+func TestLongPoll_onPoll_success(t *testing.T) {
+	ps := longpoll.New()
+	defer ps.Shutdown()
+	id := ps.MustSubscribe(time.Minute, "A")
+	ps.PublishSync(map[string]int{"a": 1}, "A")
+	ps.PublishSync(map[string]int{"a": 2}, "A")
+	batchch, _ := ps.Poll(id, time.Second, longpoll.GetOptions{MaxBytes: 7})
+	if batch := <-batchch; len(batch.Messages) != 1 || !batch.More {
+		t.Error("expected 1 message and more")
+	}
+	if _, err := ps.Poll("whatever", time.Second, longpoll.GetOptions{}); err == nil {
+		t.Error("error expected")
+	}
+}
+
+func TestLongPoll_onShutdown_drainsQueuesAndFlagsGoingAway(t *testing.T) {
+	tolerance := 25 * time.Millisecond
+
+	ps := longpoll.New()
+	id1 := ps.MustSubscribe(time.Minute, "A")
+	id2 := ps.MustSubscribe(time.Minute, "A")
+	ps.PublishSync("queued", "A")
+	datach1, _ := ps.Get(id1, time.Minute)
+	<-datach1
+	batchch1, _ := ps.Poll(id1, time.Minute, longpoll.GetOptions{})
+	time.Sleep(tolerance)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- ps.ShutdownContext(context.Background())
+	}()
+	batch := <-batchch1
+	if len(batch.Messages) != 0 || !batch.GoingAway {
+		t.Errorf("expected waiting get to return going away, found %v", batch)
+	}
+	if _, err := ps.Subscribe(time.Minute, "A"); err == nil {
+		t.Error("expected subscribe rejected while shutting down")
+	}
+	if _, err := ps.PublishSync("rejected", "A"); err == nil {
+		t.Error("expected publish rejected while shutting down")
+	}
+	select {
+	case <-done:
+		t.Fatal("expected shutdown to wait for undrained queue")
+	case <-time.After(tolerance):
+	}
+	batchch2, err := ps.Poll(id2, time.Minute, longpoll.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch = <-batchch2
+	if len(batch.Messages) != 1 || batch.Messages[0].Data != "queued" || !batch.GoingAway {
+		t.Errorf("expected queued data going away, found %v", batch)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("expected drained shutdown, found %v", err)
+	}
+	if ps.IsAlive() || len(ps.Ids()) > 0 {
+		t.Error("expected pubsub down")
+	}
+}
+
+func TestLongPoll_onShutdown_forcedUponDeadline(t *testing.T) {
+	deadline := 100 * time.Millisecond
+	tolerance := 25 * time.Millisecond
+
+	ps := longpoll.New()
+	id := ps.MustSubscribe(time.Minute, "A")
+	ps.PublishSync("never collected", "A")
+	ch, _ := ps.Channel(id)
+
+	ctx, cancel := context.WithTimeout(context.Background(), deadline)
+	defer cancel()
+	start := time.Now()
+	if err := ps.ShutdownContext(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected deadline error, found %v", err)
+	}
+	if elapsed := time.Now().Sub(start); elapsed < deadline || elapsed > deadline+2*tolerance {
+		t.Errorf("unexpected shutdown duration %v", elapsed)
+	}
+	if ch.IsAlive() || ps.IsAlive() {
+		t.Error("expected channel and pubsub down")
+	}
+}
+
+func TestLongPoll_onShutdown_withConcurrentGets_waitsForAll(t *testing.T) {
+	ps := longpoll.New()
+	id := ps.MustSubscribe(time.Minute, "A")
+	stopped := make(chan bool)
+	go func() {
+		for ps.IsAlive() {
+			if datach, err := ps.Get(id, 10*time.Millisecond); err == nil {
+				<-datach
+			}
+		}
+		stopped <- true
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := ps.ShutdownContext(ctx); err != nil {
+		t.Errorf("expected shutdown, found %v", err)
+	}
+	<-stopped
+}
+
+func TestLongPoll_onClose_dropsImmediately(t *testing.T) {
+	ps := longpoll.New()
+	id := ps.MustSubscribe(time.Minute, "A")
+	ps.PublishSync("discarded", "A")
+	ch, _ := ps.Channel(id)
+	ps.Close()
+	if ch.IsAlive() || ps.IsAlive() {
+		t.Error("expected channel and pubsub down")
+	}
+	if err := ps.ShutdownContext(context.Background()); err != nil {
+		t.Error("expected shutdown ignored when down")
+	}
+}
+
+func TestLongPoll_onStart_afterShutdown_reusable(t *testing.T) {
+	ps := longpoll.New()
+	ps.MustSubscribe(time.Minute, "A")
+	ps.PublishRetained("retained", "A")
+	if err := ps.Start(); err == nil {
+		t.Error("expected error when up")
+	}
+	// the retained value is never collected: forced shutdown
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	ps.ShutdownContext(ctx)
+	if err := ps.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer ps.Close()
+	if !ps.IsAlive() {
+		t.Error("expected pubsub up")
+	}
+	if len(ps.Ids()) != 0 || len(ps.Retained()) != 0 {
+		t.Error("expected clean state")
+	}
+	id := ps.MustSubscribe(time.Minute, "A")
+	if n, err := ps.PublishSync("new", "A"); n != 1 || err != nil {
+		t.Errorf("unexpected publish result %v, %v", n, err)
+	}
+	datach, _ := ps.Get(id, time.Second)
+	if data := <-datach; len(data) != 1 || data[0] != "new" {
+		t.Errorf("unexpected data %v", data)
+	}
+}
+
+func TestLongPoll_onStart_afterClose_reusable(t *testing.T) {
+	ps := longpoll.New()
+	ps.Close()
+	if err := ps.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer ps.Close()
+	if _, err := ps.Subscribe(time.Minute, "A"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLongPoll_onRestart_dropsSubscriptionsAndStays(t *testing.T) {
+	ps := longpoll.New()
+	defer ps.Close()
+	id := ps.MustSubscribe(time.Minute, "A")
+	if err := ps.Restart(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ps.Channel(id); ok {
+		t.Error("expected old subscription dropped")
+	}
+	if !ps.IsAlive() {
+		t.Error("expected pubsub up")
+	}
+	if _, err := ps.Subscribe(time.Minute, "A"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLongPoll_onList_filtersAndPages(t *testing.T) {
+	ps := longpoll.New()
+	defer ps.Close()
+	var ids []string
+	for i := 0; i < 5; i++ {
+		owner := "alice"
+		if i%2 == 1 {
+			owner = "bob"
+		}
+		id, _ := ps.SubscribeWith(time.Minute, longpoll.SubscribeOptions{Owner: owner}, "A")
+		ids = append(ids, id)
+		time.Sleep(time.Millisecond)
+	}
+
+	infos, total := ps.List(nil, 1, 2)
+	if total != 5 || len(infos) != 2 || infos[0].ID != ids[1] || infos[1].ID != ids[2] {
+		t.Errorf("unexpected page %v of %v", infos, total)
+	}
+	alice := func(info longpoll.ChannelInfo) bool { return info.Owner == "alice" }
+	infos, total = ps.List(alice, 0, 0)
+	if total != 3 || len(infos) != 3 || infos[2].ID != ids[4] {
+		t.Errorf("unexpected filtered list %v of %v", infos, total)
+	}
+	if infos, total = ps.List(alice, 10, 2); total != 3 || len(infos) != 0 {
+		t.Errorf("expected empty page, found %v of %v", infos, total)
+	}
+}
+
+func TestLongPoll_onRateLimits_rejectsWithRateLimitError(t *testing.T) {
+	ps := longpoll.New()
+	defer ps.Close()
+	ps.SetRateLimits(longpoll.RateLimits{
+		Subscribe: longpoll.NewTokenBucket(1, 1),
+		Get:       longpoll.NewTokenBucket(1, 1),
+		Publish:   longpoll.NewTokenBucket(1, 1),
+	})
+
+	id, err := ps.SubscribeWith(time.Minute, longpoll.SubscribeOptions{Owner: "alice"}, "A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ps.SubscribeWith(time.Minute, longpoll.SubscribeOptions{Owner: "alice"}, "A")
+	if lerr, ok := err.(*longpoll.RateLimitError); !ok || lerr.Op != "subscribe" || lerr.Key != "alice" || lerr.RetryAfter <= 0 {
+		t.Errorf("expected subscribe rate limit error, found %v", err)
+	}
+	if _, err = ps.SubscribeWith(time.Minute, longpoll.SubscribeOptions{Owner: "bob"}, "B"); err != nil {
+		t.Errorf("expected other owner unaffected, found %v", err)
+	}
+
+	if _, err := ps.PublishSync(1, "A"); err != nil {
+		t.Error(err)
+	}
+	if err := ps.Publish(2, "B", "A"); err == nil {
+		t.Error("expected publish rate limit error")
+	} else if lerr, ok := err.(*longpoll.RateLimitError); !ok || lerr.Op != "publish" || lerr.Key != "A" {
+		t.Errorf("expected publish rate limit error, found %v", err)
+	}
+	if _, err := ps.PublishSync(3, "B"); err != nil {
+		t.Errorf("expected no token taken for B by the rejected publication, found %v", err)
+	}
+
+	if _, err := ps.Poll(id, time.Second, longpoll.GetOptions{}); err != nil {
+		t.Error(err)
+	}
+	if _, err := ps.Get(id, time.Second); err == nil {
+		t.Error("expected get rate limit error")
+	} else if lerr, ok := err.(*longpoll.RateLimitError); !ok || lerr.Op != "get" || lerr.Key != "alice" {
+		t.Errorf("expected get rate limit error, found %v", err)
+	}
+
+	ps.SetRateLimits(longpoll.RateLimits{})
+	if _, err := ps.Get(id, time.Second); err != nil {
+		t.Errorf("expected limits removed, found %v", err)
+	}
+}
+
+func TestLongPoll_onQuotas_rejectNew(t *testing.T) {
+	ps := longpoll.New()
+	defer ps.Close()
+	ps.SetQuotas(longpoll.Quotas{MaxSubscriptions: 3, MaxPerOwner: 2, MaxTopics: 2})
+	alice := longpoll.SubscribeOptions{Owner: "alice"}
+
+	if _, err := ps.SubscribeWith(time.Minute, alice, "A", "B", "C"); err == nil {
+		t.Error("expected topics quota error")
+	} else if qerr, ok := err.(*longpoll.QuotaError); !ok || qerr.Limit != 2 {
+		t.Errorf("expected topics quota error, found %v", err)
+	}
+	ps.SubscribeWith(time.Minute, alice, "A", "B")
+	ps.SubscribeWith(time.Minute, alice, "A")
+	if _, err := ps.SubscribeWith(time.Minute, alice, "A"); err == nil {
+		t.Error("expected owner quota error")
+	} else if qerr, ok := err.(*longpoll.QuotaError); !ok || qerr.Limit != 2 {
+		t.Errorf("expected owner quota error, found %v", err)
+	}
+	if _, err := ps.Subscribe(time.Minute, "A"); err != nil {
+		t.Errorf("expected subscription without owner, found %v", err)
+	}
+	if _, err := ps.SubscribeWith(time.Minute, longpoll.SubscribeOptions{Owner: "bob"}, "A"); err == nil {
+		t.Error("expected global quota error")
+	} else if qerr, ok := err.(*longpoll.QuotaError); !ok || qerr.Limit != 3 {
+		t.Errorf("expected global quota error, found %v", err)
+	}
+	if len(ps.Ids()) != 3 {
+		t.Errorf("expected 3 subscriptions, found %v", len(ps.Ids()))
+	}
+}
+
+func TestLongPoll_onQuotas_dropOldest(t *testing.T) {
+	ps := longpoll.New()
+	defer ps.Close()
+	ps.SetQuotas(longpoll.Quotas{MaxSubscriptions: 3, MaxPerOwner: 2, Eviction: longpoll.DropOldest})
+	alice := longpoll.SubscribeOptions{Owner: "alice"}
+
+	anon := ps.MustSubscribe(time.Minute, "A")
+	time.Sleep(time.Millisecond)
+	alice1, _ := ps.SubscribeWith(time.Minute, alice, "A")
+	time.Sleep(time.Millisecond)
+	alice2, _ := ps.SubscribeWith(time.Minute, alice, "A")
+	time.Sleep(time.Millisecond)
+	alice3, err := ps.SubscribeWith(time.Minute, alice, "A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, expected := range map[string]bool{anon: true, alice1: false, alice2: true, alice3: true} {
+		if _, ok := ps.Channel(id); ok != expected {
+			t.Errorf("expected %v alive %v", id, expected)
+		}
+	}
+	// global quota reached: the oldest overall goes
+	bob, err := ps.SubscribeWith(time.Minute, longpoll.SubscribeOptions{Owner: "bob"}, "A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ps.Channel(anon); ok {
+		t.Error("expected oldest subscription dropped")
+	}
+	if _, ok := ps.Channel(bob); !ok || len(ps.Ids()) != 3 {
+		t.Errorf("expected 3 subscriptions, found %v", ps.Ids())
+	}
+}
+
+func TestLongPoll_onSubscribeWithTransform_reshapesPerSubscription(t *testing.T) {
+	ps := longpoll.New()
+	defer ps.Close()
+	full := ps.MustSubscribe(time.Minute, "A")
+	slim, _ := ps.SubscribeWith(time.Minute, longpoll.SubscribeOptions{Transform: longpoll.Project("id")}, "A")
+
+	ps.PublishSync(map[string]interface{}{"id": 1, "text": "long"}, "A")
+	fullch, _ := ps.GetMessages(full, time.Second)
+	slimch, _ := ps.GetMessages(slim, time.Second)
+	fullmsgs, slimmsgs := <-fullch, <-slimch
+	if len(fullmsgs[0].Data.(map[string]interface{})) != 2 {
+		t.Errorf("expected original data, found %v", fullmsgs[0].Data)
+	}
+	if data := slimmsgs[0].Data.(map[string]interface{}); len(data) != 1 || data["id"] != 1 {
+		t.Errorf("expected projected data, found %v", data)
+	}
+	if slimmsgs[0].Seq != fullmsgs[0].Seq || slimmsgs[0].Topic != "A" {
+		t.Error("expected envelope kept")
+	}
+}
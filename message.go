@@ -0,0 +1,164 @@
+// Copyright (c) 2015-2017. Oleg Sklyar & teris.io. All rights reserved.
+// See the LICENSE file in the project root for licensing information.
+
+package longpoll
+
+import (
+	"encoding/json"
+	"sync/atomic"
+	"time"
+)
+
+// Message represents a unit of published data along with the topic it was published to, its
+// sequence number and the time of publishing. Sequence numbers are unique and increase
+// monotonically across all publishing within the process.
+//
+// A message published via LongPoll is shared by all of the receiving subscription channels and
+// must not be modified.
+type Message struct {
+	Seq   uint64      `json:"seq"`
+	Topic string      `json:"topic"`
+	Time  time.Time   `json:"time"`
+	Data  interface{} `json:"data"`
+
+	// time to live in a subscription queue, zero for the subscription channel default
+	ttl time.Duration
+	// conflation key, empty for none
+	key string
+	// delivery priority, higher first
+	priority int
+	// cached size estimate plus one, zero if not yet computed
+	bytes int64
+	// cached generic form of the data shared by the filters and transforms of all channels
+	doc atomic.Value
+	// cached encodings shared by all responses, nil unless published with the Shared option
+	shared *encodings
+	// subscription channels to deliver to by their labels, nil for all
+	selector Selector
+}
+
+// Sizer can be implemented by published data to report its size for the MaxBytes limit of
+// GetOptions.
+type Sizer interface {
+	Size() int
+}
+
+// PublishOptions define optional properties of published messages, see (*LongPoll).PublishWith.
+type PublishOptions struct {
+	// TTL limits the time a message may wait in a subscription queue before it is discarded
+	// undelivered. Zero falls back to the default of the subscription channel, see SetTTL.
+	TTL time.Duration
+	// Key enables conflation: a message replaces the undelivered message with the same key and
+	// topic in the subscription queue in place, so that slow clients receive only the latest value
+	// per key. Empty keys are never conflated.
+	Key string
+	// Priority defines the order of delivery of queued messages: messages with higher priority are
+	// delivered first, in the order of publishing within the same priority. Default is zero.
+	Priority int
+	// Shared caches the encoding of the message by the Handler codecs and compressors, so that a
+	// message published to many subscribers is encoded once per format rather than for every
+	// response. It trades memory for CPU and pays off for large payloads with a large fan-out.
+	Shared bool
+	// Selector limits the delivery to the subscription channels with labels accepted by it, e.g.
+	// of a single tenant, see SubscribeOptions.Labels. This applies to replays of the message from
+	// the history as well. Nil delivers to all subscription channels of the topic.
+	Selector Selector
+}
+
+var seqno uint64
+
+func newMessage(data interface{}, topic string) *Message {
+	return &Message{
+		Seq:   atomic.AddUint64(&seqno, 1),
+		Topic: topic,
+		Time:  time.Now(),
+		Data:  data,
+	}
+}
+
+func newMessageWith(data interface{}, topic string, opts PublishOptions) *Message {
+	msg := newMessage(data, topic)
+	msg.ttl = opts.TTL
+	msg.key = opts.Key
+	msg.priority = opts.Priority
+	msg.selector = opts.Selector
+	if opts.Shared {
+		msg.shared = &encodings{cache: make(map[string][]byte)}
+	}
+	return msg
+}
+
+// GetOptions define optional limits of a response to a Get request, see (*Channel).Poll.
+type GetOptions struct {
+	// MaxMessages limits the number of messages in the response, zero for no limit.
+	MaxMessages int
+	// MaxBytes limits the total size of messages in the response, zero for no limit. The size of
+	// []byte and string data is its length, that of a Sizer is reported by it, and that of other
+	// data is the length of its JSON encoding. A response contains at least one message, however
+	// large.
+	MaxBytes int
+	// Linger delays the response after the first message has arrived for up to the given duration
+	// to collect further messages, unless MaxMessages or MaxBytes are reached earlier. Data that
+	// has been waiting at the time of the request is returned immediately.
+	Linger time.Duration
+}
+
+// Batch represents a response to a Get request.
+type Batch struct {
+	Messages []*Message `json:"messages"`
+	// More reports that further messages have remained queued and can be received immediately.
+	More bool `json:"more,omitempty"`
+	// GoingAway reports that the service is shutting down and the client should reconnect
+	// elsewhere once it has received the remaining messages.
+	GoingAway bool `json:"goingAway,omitempty"`
+}
+
+// size returns the estimated size of the message data, computing it once.
+func (msg *Message) size() int {
+	if bytes := atomic.LoadInt64(&msg.bytes); bytes > 0 {
+		return int(bytes - 1)
+	}
+	var res int
+	switch data := msg.Data.(type) {
+	case []byte:
+		res = len(data)
+	case string:
+		res = len(data)
+	case Sizer:
+		res = data.Size()
+	default:
+		if encoded, err := json.Marshal(data); err == nil {
+			res = len(encoded)
+		}
+	}
+	atomic.StoreInt64(&msg.bytes, int64(res)+1)
+	return res
+}
+
+// docref wraps the generic form of the data as atomic.Value does not store nil.
+type docref struct {
+	doc interface{}
+}
+
+// document returns the generic form of the message data for field lookup, converting it once for
+// all receiving channels. The result must not be modified.
+func (msg *Message) document() interface{} {
+	if ref, ok := msg.doc.Load().(docref); ok {
+		return ref.doc
+	}
+	res := document(msg.Data)
+	msg.doc.Store(docref{doc: res})
+	return res
+}
+
+// payloads extracts published data from messages, retaining nil for no messages.
+func payloads(msgs []*Message) []interface{} {
+	if msgs == nil {
+		return nil
+	}
+	res := make([]interface{}, len(msgs))
+	for i, msg := range msgs {
+		res[i] = msg.Data
+	}
+	return res
+}
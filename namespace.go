@@ -0,0 +1,97 @@
+// Copyright (c) 2015-2017. Oleg Sklyar & teris.io. All rights reserved.
+// See the LICENSE file in the project root for licensing information.
+
+package longpoll
+
+import (
+	"context"
+	"sort"
+)
+
+// Namespace returns the namespace of the given name, creating it on first use, for hosting several
+// tenants in one process in isolation. A namespace is a LongPoll of its own: its topics, ids,
+// history, retained values, quotas, rate limits, presence and stats are separate from those of the
+// parent and of other namespaces, and it can be served by its own Handler and AdminHandler.
+// Namespaces run no goroutines of their own, the subscription channels of all namespaces are
+// managed alike. Shutting a namespace down drops only its own subscription channels, while
+// shutting down or closing the parent applies to all of its namespaces. Namespaces stay in place
+// either way, so that references to them, e.g. held by handlers, remain valid: a namespace shut
+// down on its own can be started again, see Start, and Start of the parent starts all of its
+// namespaces. A namespace requested while the parent is down is down as well until the parent is
+// started.
+func (lp *LongPoll) Namespace(name string) *LongPoll {
+	lp.mx.Lock()
+	defer lp.mx.Unlock()
+	if ns, ok := lp.namespaces[name]; ok {
+		return ns
+	}
+	ns := New()
+	ns.name = name
+	if !lp.IsAlive() {
+		ns.alive = no
+	}
+	if lp.namespaces == nil {
+		lp.namespaces = make(map[string]*LongPoll)
+	}
+	lp.namespaces[name] = ns
+	return ns
+}
+
+// Namespaces returns the names of the namespaces created so far, see Namespace.
+func (lp *LongPoll) Namespaces() []string {
+	lp.mx.Lock()
+	defer lp.mx.Unlock()
+	var res []string
+	for name := range lp.namespaces {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Name returns the name of the namespace, empty for a LongPoll created by New.
+func (lp *LongPoll) Name() string {
+	return lp.name
+}
+
+// shutdownNamespaces shuts all namespaces down concurrently and returns the first error.
+func (lp *LongPoll) shutdownNamespaces(ctx context.Context) error {
+	lp.mx.Lock()
+	var nss []*LongPoll
+	for _, ns := range lp.namespaces {
+		nss = append(nss, ns)
+	}
+	lp.mx.Unlock()
+
+	errs := make(chan error, len(nss))
+	for _, ns := range nss {
+		go func(ns *LongPoll) {
+			errs <- ns.ShutdownContext(ctx)
+		}(ns)
+	}
+	var res error
+	for range nss {
+		if err := <-errs; err != nil && res == nil {
+			res = err
+		}
+	}
+	return res
+}
+
+// closeNamespaces closes all namespaces and returns their channels. Must be called under lock.
+func (lp *LongPoll) closeNamespaces() []*Channel {
+	var res []*Channel
+	for _, ns := range lp.namespaces {
+		res = append(res, ns.close()...)
+	}
+	return res
+}
+
+// startNamespaces starts all namespaces that are down. Must be called under lock.
+func (lp *LongPoll) startNamespaces() {
+	for _, ns := range lp.namespaces {
+		if !ns.IsAlive() {
+			ns.Start()
+		}
+	}
+}
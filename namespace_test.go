@@ -0,0 +1,138 @@
+// Copyright (c) 2015-2017. Oleg Sklyar & teris.io. All rights reserved.
+// See the LICENSE file in the project root for licensing information.
+
+package longpoll_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/teris-io/longpoll"
+)
+
+func TestLongPoll_onNamespace_isolates(t *testing.T) {
+	ps := longpoll.New()
+	defer ps.Close()
+	acme, other := ps.Namespace("acme"), ps.Namespace("other")
+	if ps.Namespace("acme") != acme || acme.Name() != "acme" || ps.Name() != "" {
+		t.Fatal("expected the same namespace by name")
+	}
+	if names := ps.Namespaces(); len(names) != 2 || names[0] != "acme" || names[1] != "other" {
+		t.Errorf("unexpected namespaces %v", names)
+	}
+	root := ps.MustSubscribe(time.Minute, "A")
+	id := acme.MustSubscribe(time.Minute, "A")
+	other.MustSubscribe(time.Minute, "B")
+
+	if n, _ := acme.PublishSync("acme", "A"); n != 1 {
+		t.Errorf("expected 1 receiver, found %d", n)
+	}
+	if ch, _ := ps.Channel(root); ch.QueueSize() != 0 {
+		t.Error("expected no data leaking into the parent")
+	}
+	if _, ok := ps.Channel(id); ok {
+		t.Error("expected the namespace id unknown to the parent")
+	}
+	if _, ok := other.Channel(id); ok {
+		t.Error("expected the namespace id unknown to another namespace")
+	}
+	if topics := other.Topics(); len(topics) != 1 || topics[0] != "B" {
+		t.Errorf("unexpected topics %v", topics)
+	}
+	if stats := ps.Stats(); stats.Delivered != 0 {
+		t.Errorf("unexpected parent stats %v", stats)
+	}
+
+	acme.SetQuotas(longpoll.Quotas{MaxSubscriptions: 1})
+	if _, err := acme.Subscribe(time.Minute, "A"); err == nil {
+		t.Error("expected the namespace quota to apply")
+	}
+	if _, err := other.Subscribe(time.Minute, "A"); err != nil {
+		t.Errorf("expected no quota in another namespace, found %v", err)
+	}
+}
+
+func TestLongPoll_onNamespaceShutdown_dropsOwnChannelsOnly(t *testing.T) {
+	ps := longpoll.New()
+	defer ps.Close()
+	acme := ps.Namespace("acme")
+	id := acme.MustSubscribe(time.Minute, "A")
+	root := ps.MustSubscribe(time.Minute, "A")
+
+	if err := acme.ShutdownContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if acme.IsAlive() || !ps.IsAlive() {
+		t.Error("expected the namespace down and the parent up")
+	}
+	if _, ok := ps.Channel(root); !ok {
+		t.Error("expected the parent channel alive")
+	}
+	if ps.Namespace("acme") != acme {
+		t.Error("expected the namespace to stay in place")
+	}
+	if err := acme.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := acme.Channel(id); ok {
+		t.Error("expected the namespace to start empty")
+	}
+}
+
+func TestLongPoll_onShutdownAndClose_appliesToNamespaces(t *testing.T) {
+	ps := longpoll.New()
+	acme := ps.Namespace("acme")
+	acme.MustSubscribe(time.Minute, "A")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := ps.ShutdownContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if acme.IsAlive() || len(acme.Ids()) != 0 {
+		t.Error("expected the namespace down")
+	}
+	if len(ps.Namespaces()) != 1 || ps.Namespace("acme") != acme {
+		t.Error("expected namespaces kept while the parent is down")
+	}
+	globex := ps.Namespace("globex")
+	if globex.IsAlive() {
+		t.Error("expected a namespace requested while the parent is down to be down")
+	}
+
+	ps.Start()
+	if !acme.IsAlive() || !globex.IsAlive() {
+		t.Error("expected namespaces started with the parent")
+	}
+	acme.MustSubscribe(time.Minute, "A")
+	ps.Close()
+	if acme.IsAlive() {
+		t.Error("expected the namespace closed")
+	}
+}
+
+func TestLongPoll_onRestart_keepsNamespacesUsable(t *testing.T) {
+	ps := longpoll.New()
+	defer ps.Close()
+	acme := ps.Namespace("acme")
+	acme.MustSubscribe(time.Minute, "A")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := ps.Restart(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ps.Namespace("acme") != acme || !acme.IsAlive() || len(acme.Ids()) != 0 {
+		t.Fatal("expected the same namespace up and empty")
+	}
+	id := acme.MustSubscribe(time.Minute, "A")
+	if err := acme.Publish("data", "A"); err != nil {
+		t.Fatal(err)
+	}
+	ch, _ := acme.Channel(id)
+	datach, _ := ch.Get(time.Second)
+	if data := <-datach; len(data) != 1 || data[0] != "data" {
+		t.Errorf("expected data received after restart, found %v", data)
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2015-2017. Oleg Sklyar & teris.io. All rights reserved.
+// See the LICENSE file in the project root for licensing information.
+
+package longpoll
+
+import "sort"
+
+// PresenceTopic is the conventional system topic for presence events, see SetPresenceTopic.
+const PresenceTopic = "$presence"
+
+// Presence event types, see PresenceEvent.
+const (
+	// PresenceSubscribe reports a new subscription to the topic.
+	PresenceSubscribe = "subscribe"
+	// PresenceTimeout reports a subscription that timed out for lack of Get requests.
+	PresenceTimeout = "timeout"
+	// PresenceDrop reports a subscription dropped explicitly or evicted.
+	PresenceDrop = "drop"
+)
+
+// PresenceEvent is the data published on the presence topic when a subscription channel joins or
+// leaves one of its topics, see SetPresenceTopic.
+type PresenceEvent struct {
+	// Event is one of PresenceSubscribe, PresenceTimeout or PresenceDrop.
+	Event string `json:"event"`
+	Topic string `json:"topic"`
+	ID    string `json:"id"`
+	// Owner is the principal owning the subscription if known, see SubscribeOptions.
+	Owner string `json:"owner,omitempty"`
+}
+
+// SetPresenceTopic enables presence events published on the given system topic, one for every
+// topic of a subscription channel that is subscribed, times out or is dropped, so that clients can
+// follow who joins and leaves a topic by subscribing to the system topic, e.g. with a filter on
+// the topic field. Subscriptions to the system topic itself are not reported. Presence events are
+// not subject to rate limits and are not published during shutdown. An empty topic, the default,
+// disables the events.
+func (lp *LongPoll) SetPresenceTopic(topic string) {
+	lp.mx.Lock()
+	lp.presenceTopic = topic
+	lp.mx.Unlock()
+}
+
+// Presence returns the snapshots of the subscription channels currently subscribed to the topic,
+// in the order of subscribing. The owner of each identifies the principal present, see
+// SubscribeOptions.Owner.
+func (lp *LongPoll) Presence(topic string) []ChannelInfo {
+	res, _ := lp.List(func(info ChannelInfo) bool {
+		for _, t := range info.Topics {
+			if t == topic {
+				return true
+			}
+		}
+		return false
+	}, 0, 0)
+	return res
+}
+
+// presence publishes the presence event for all topics of the channel if enabled.
+func (lp *LongPoll) presence(ch *Channel, event string) {
+	lp.mx.Lock()
+	system := lp.presenceTopic
+	lp.mx.Unlock()
+	if system == "" || !lp.isAccepting() {
+		return
+	}
+	topics := ch.Topics()
+	sort.Strings(topics)
+	for _, topic := range topics {
+		if topic == system {
+			continue
+		}
+		data := PresenceEvent{Event: event, Topic: topic, ID: ch.id, Owner: ch.Owner()}
+		msgs, chs := lp.prepare(data, PublishOptions{}, []string{system}, false)
+		publishSync(chs, msgs) // errors ignored: channels closed concurrently
+	}
+}
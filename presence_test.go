@@ -0,0 +1,96 @@
+// Copyright (c) 2015-2017. Oleg Sklyar & teris.io. All rights reserved.
+// See the LICENSE file in the project root for licensing information.
+
+package longpoll_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/teris-io/longpoll"
+)
+
+func presenceEvents(t *testing.T, ps *longpoll.LongPoll, id string, n int) []longpoll.PresenceEvent {
+	var res []longpoll.PresenceEvent
+	for len(res) < n {
+		msgch, err := ps.GetMessages(id, time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msgs := <-msgch
+		if len(msgs) == 0 {
+			t.Fatalf("expected %d events, found %v", n, res)
+		}
+		for _, msg := range msgs {
+			if msg.Topic != longpoll.PresenceTopic {
+				t.Errorf("unexpected topic %q", msg.Topic)
+			}
+			res = append(res, msg.Data.(longpoll.PresenceEvent))
+		}
+	}
+	return res
+}
+
+func TestLongPoll_onPresence_listsSubscriptionsOfTopic(t *testing.T) {
+	ps := longpoll.New()
+	defer ps.Close()
+	alice, _ := ps.SubscribeWith(time.Minute, longpoll.SubscribeOptions{Owner: "alice"}, "doc1", "doc2")
+	time.Sleep(time.Millisecond)
+	bob, _ := ps.SubscribeWith(time.Minute, longpoll.SubscribeOptions{Owner: "bob"}, "doc1")
+	ps.MustSubscribe(time.Minute, "doc3")
+
+	present := ps.Presence("doc1")
+	if len(present) != 2 || present[0].ID != alice || present[0].Owner != "alice" ||
+		present[1].ID != bob || present[1].Owner != "bob" {
+		t.Errorf("unexpected presence %v", present)
+	}
+	ps.Drop(alice)
+	if present = ps.Presence("doc1"); len(present) != 1 || present[0].ID != bob {
+		t.Errorf("unexpected presence after drop %v", present)
+	}
+	if present = ps.Presence("unknown"); len(present) != 0 {
+		t.Errorf("unexpected presence %v", present)
+	}
+}
+
+func TestLongPoll_onPresenceTopic_publishesJoinAndLeave(t *testing.T) {
+	ps := longpoll.New()
+	defer ps.Close()
+	ps.SetPresenceTopic(longpoll.PresenceTopic)
+	watcher := ps.MustSubscribe(time.Minute, longpoll.PresenceTopic)
+
+	alice, _ := ps.SubscribeWith(time.Minute, longpoll.SubscribeOptions{Owner: "alice"}, "doc2", "doc1")
+	bob, _ := ps.SubscribeWith(50*time.Millisecond, longpoll.SubscribeOptions{Owner: "bob"}, "doc1")
+	ps.Drop(alice)
+	expected := []longpoll.PresenceEvent{
+		{Event: longpoll.PresenceSubscribe, Topic: "doc1", ID: alice, Owner: "alice"},
+		{Event: longpoll.PresenceSubscribe, Topic: "doc2", ID: alice, Owner: "alice"},
+		{Event: longpoll.PresenceSubscribe, Topic: "doc1", ID: bob, Owner: "bob"},
+		{Event: longpoll.PresenceDrop, Topic: "doc1", ID: alice, Owner: "alice"},
+		{Event: longpoll.PresenceDrop, Topic: "doc2", ID: alice, Owner: "alice"},
+		{Event: longpoll.PresenceTimeout, Topic: "doc1", ID: bob, Owner: "bob"},
+	}
+	events := presenceEvents(t, ps, watcher, len(expected))
+	if len(events) != len(expected) {
+		t.Fatalf("expected %v, found %v", expected, events)
+	}
+	for i, event := range events {
+		if event != expected[i] {
+			t.Errorf("expected %v, found %v", expected[i], event)
+		}
+	}
+}
+
+func TestLongPoll_onPresenceTopicDisabled_publishesNothing(t *testing.T) {
+	ps := longpoll.New()
+	defer ps.Close()
+	watcher := ps.MustSubscribe(time.Minute, longpoll.PresenceTopic)
+	ps.Drop(ps.MustSubscribe(time.Minute, "doc1"))
+
+	ps.SetPresenceTopic(longpoll.PresenceTopic)
+	ps.SetPresenceTopic("")
+	ps.MustSubscribe(time.Minute, "doc1")
+	if ch, _ := ps.Channel(watcher); ch.QueueSize() != 0 {
+		t.Errorf("expected no events, found %d", ch.QueueSize())
+	}
+}
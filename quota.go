@@ -0,0 +1,70 @@
+// Copyright (c) 2015-2017. Oleg Sklyar & teris.io. All rights reserved.
+// See the LICENSE file in the project root for licensing information.
+
+package longpoll
+
+// Quotas define hard limits enforced on subscribing by a LongPoll, see SetQuotas. Zero values
+// impose no limit.
+type Quotas struct {
+	// MaxSubscriptions caps the number of subscription channels of the LongPoll.
+	MaxSubscriptions int
+	// MaxPerOwner caps the number of subscription channels per owner, see SubscribeOptions.Owner.
+	// Subscriptions without an owner are not subject to this quota.
+	MaxPerOwner int
+	// MaxTopics caps the number of topics per subscription.
+	MaxTopics int
+	// Eviction defines the behaviour when a cap on the number of subscription channels is reached.
+	Eviction Eviction
+}
+
+// Eviction defines the behaviour of Subscribe when a cap on the number of subscription channels
+// is reached.
+type Eviction int
+
+const (
+	// RejectNew rejects new subscriptions with a *QuotaError. This is the default.
+	RejectNew Eviction = iota
+	// DropOldest drops the oldest subscription channel to make room for the new one: that of the
+	// same owner if the owner's quota is reached, otherwise the oldest overall.
+	DropOldest
+)
+
+// evictee selects the subscription channel to drop for a new one of the given owner, returning a
+// *QuotaError if the quotas do not permit one. Must be called under lock.
+func (lp *LongPoll) evictee(owner string) (*Channel, error) {
+	quotas := lp.quotas
+	if quotas.MaxSubscriptions <= 0 && (quotas.MaxPerOwner <= 0 || owner == "") {
+		return nil, nil
+	}
+	var oldest, oldestOwned *Channel
+	total, owned := 0, 0
+	for _, ch := range lp.chmap {
+		if !ch.IsAlive() {
+			// dropped, but not yet removed
+			continue
+		}
+		total++
+		if oldest == nil || ch.created.Before(oldest.created) {
+			oldest = ch
+		}
+		if owner != "" && ch.Owner() == owner {
+			owned++
+			if oldestOwned == nil || ch.created.Before(oldestOwned.created) {
+				oldestOwned = ch
+			}
+		}
+	}
+	switch {
+	case quotas.MaxPerOwner > 0 && owner != "" && owned >= quotas.MaxPerOwner:
+		if quotas.Eviction == DropOldest {
+			return oldestOwned, nil
+		}
+		return nil, &QuotaError{Quota: "subscriptions per owner", Limit: quotas.MaxPerOwner}
+	case quotas.MaxSubscriptions > 0 && total >= quotas.MaxSubscriptions:
+		if quotas.Eviction == DropOldest {
+			return oldest, nil
+		}
+		return nil, &QuotaError{Quota: "subscriptions", Limit: quotas.MaxSubscriptions}
+	}
+	return nil, nil
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2015-2017. Oleg Sklyar & teris.io. All rights reserved.
+// See the LICENSE file in the project root for licensing information.
+
+package longpoll
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Limiter decides whether a call identified by the key, e.g. a principal, an IP address or a
+// topic, may proceed. If not, it returns the time after which a retry is expected to succeed.
+type Limiter interface {
+	Allow(key string) (bool, time.Duration)
+}
+
+// MultiLimiter is a Limiter that can also decide on several keys at once, letting the call
+// proceed for all of them or for none. Publishing to several topics uses it if implemented, so
+// that a rejected publication does not count against the limits of the other topics.
+type MultiLimiter interface {
+	Limiter
+	// AllowAll returns the first limited key along with the time after which a retry is expected
+	// to succeed, or true if none is limited.
+	AllowAll(keys []string) (bool, string, time.Duration)
+}
+
+// RateLimits define the limiters applied by a LongPoll, see SetRateLimits. A nil limiter imposes
+// no limit.
+type RateLimits struct {
+	// Subscribe limits new subscriptions keyed by SubscribeOptions.Owner.
+	Subscribe Limiter
+	// Get limits Get requests keyed by the owner of the subscription channel, or its Id if the
+	// owner is not known.
+	Get Limiter
+	// Publish limits publishing keyed by topic.
+	Publish Limiter
+}
+
+// TokenBucket is a Limiter maintaining a token bucket per key. Every call takes a token, tokens
+// are replenished at a constant rate up to the bucket capacity permitting bursts.
+type TokenBucket struct {
+	mx      sync.Mutex
+	rate    float64
+	burst   float64
+	buckets map[string]*bucket
+	pruned  time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket creates a token bucket limiter replenishing rate tokens per second for every key
+// with the capacity of burst tokens.
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &TokenBucket{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*bucket),
+		pruned:  time.Now(),
+	}
+}
+
+// Allow takes a token from the bucket of the key if available.
+func (tb *TokenBucket) Allow(key string) (bool, time.Duration) {
+	ok, _, retry := tb.AllowAll([]string{key})
+	return ok, retry
+}
+
+// AllowAll takes a token from the bucket of every key if all of them have one available and none
+// otherwise. A key listed repeatedly takes a token per occurrence.
+func (tb *TokenBucket) AllowAll(keys []string) (bool, string, time.Duration) {
+	now := time.Now()
+	tb.mx.Lock()
+	defer tb.mx.Unlock()
+	tb.prune(now)
+	for i, key := range keys {
+		need := 1.0
+		for _, prev := range keys[:i] {
+			if prev == key {
+				need++
+			}
+		}
+		if b := tb.refill(key, now); b.tokens < need {
+			if tb.rate <= 0 {
+				return false, key, time.Duration(math.MaxInt64)
+			}
+			return false, key, time.Duration((need - b.tokens) / tb.rate * float64(time.Second))
+		}
+	}
+	for _, key := range keys {
+		tb.buckets[key].tokens--
+	}
+	return true, "", 0
+}
+
+// refill returns the bucket of the key with the tokens replenished until now, creating a full one
+// if none exists. Must be called under lock.
+func (tb *TokenBucket) refill(key string, now time.Time) *bucket {
+	b, ok := tb.buckets[key]
+	if !ok {
+		b = &bucket{tokens: tb.burst, last: now}
+		tb.buckets[key] = b
+	}
+	b.tokens = math.Min(tb.burst, b.tokens+now.Sub(b.last).Seconds()*tb.rate)
+	b.last = now
+	return b
+}
+
+// prune removes the buckets that have been refilled completely, which behave as new ones, at
+// most once per the time needed to refill an empty bucket. Must be called under lock.
+func (tb *TokenBucket) prune(now time.Time) {
+	if tb.rate <= 0 || now.Sub(tb.pruned).Seconds() < tb.burst/tb.rate {
+		return
+	}
+	tb.pruned = now
+	for key, b := range tb.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*tb.rate >= tb.burst {
+			delete(tb.buckets, key)
+		}
+	}
+}
+
+func allow(limiter Limiter, op, key string) error {
+	if limiter == nil {
+		return nil
+	}
+	if ok, retry := limiter.Allow(key); !ok {
+		return &RateLimitError{Op: op, Key: key, RetryAfter: retry}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+// Copyright (c) 2015-2017. Oleg Sklyar & teris.io. All rights reserved.
+// See the LICENSE file in the project root for licensing information.
+
+package longpoll_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/teris-io/longpoll"
+)
+
+func TestTokenBucket_onBurst_limitsAndReplenishes(t *testing.T) {
+	tb := longpoll.NewTokenBucket(20, 3)
+	for i := 0; i < 3; i++ {
+		if ok, _ := tb.Allow("a"); !ok {
+			t.Fatalf("expected call %v within burst", i)
+		}
+	}
+	ok, retry := tb.Allow("a")
+	if ok || retry <= 0 || retry > 50*time.Millisecond {
+		t.Errorf("expected limited with retry within 50ms, found %v, %v", ok, retry)
+	}
+	if ok, _ := tb.Allow("b"); !ok {
+		t.Error("expected other keys unaffected")
+	}
+	time.Sleep(retry)
+	if ok, _ := tb.Allow("a"); !ok {
+		t.Error("expected token replenished")
+	}
+}
+
+func TestTokenBucket_onZeroRate_neverReplenishes(t *testing.T) {
+	tb := longpoll.NewTokenBucket(0, 1)
+	tb.Allow("a")
+	if ok, retry := tb.Allow("a"); ok || retry < time.Hour {
+		t.Errorf("expected limited for good, found %v, %v", ok, retry)
+	}
+}
+
+func TestTokenBucket_onAllowAllLimited_takesNoTokens(t *testing.T) {
+	tb := longpoll.NewTokenBucket(0, 2)
+	tb.Allow("b")
+	tb.Allow("b")
+	if ok, key, retry := tb.AllowAll([]string{"a", "b"}); ok || key != "b" || retry < time.Hour {
+		t.Errorf("expected b limited, found %v, %q, %v", ok, key, retry)
+	}
+	if ok, _, _ := tb.AllowAll([]string{"a", "a"}); !ok {
+		t.Error("expected both tokens of a left")
+	}
+	if ok, key, _ := tb.AllowAll([]string{"a"}); ok || key != "a" {
+		t.Errorf("expected a exhausted, found %v, %q", ok, key)
+	}
+}
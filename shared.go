@@ -0,0 +1,35 @@
+// Copyright (c) 2015-2017. Oleg Sklyar & teris.io. All rights reserved.
+// See the LICENSE file in the project root for licensing information.
+
+package longpoll
+
+import "sync"
+
+// encodings caches the encodings of a message shared by all responses, keyed by format.
+type encodings struct {
+	mx    sync.Mutex
+	cache map[string][]byte
+}
+
+// encoded returns the cached encoding of the message for the key, encoding it on first use if the
+// message is shared, and encoding it every time otherwise. Concurrent first uses may encode the
+// message more than once, which is cheaper than holding the lock while encoding.
+func (msg *Message) encoded(key string, encode func() ([]byte, error)) ([]byte, error) {
+	if msg.shared == nil {
+		return encode()
+	}
+	msg.shared.mx.Lock()
+	res, ok := msg.shared.cache[key]
+	msg.shared.mx.Unlock()
+	if ok {
+		return res, nil
+	}
+	res, err := encode()
+	if err != nil {
+		return nil, err
+	}
+	msg.shared.mx.Lock()
+	msg.shared.cache[key] = res
+	msg.shared.mx.Unlock()
+	return res, nil
+}
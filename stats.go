@@ -0,0 +1,27 @@
+// Copyright (c) 2015-2017. Oleg Sklyar & teris.io. All rights reserved.
+// See the LICENSE file in the project root for licensing information.
+
+package longpoll
+
+// Stats represents message counters of a subscription channel, or accumulated over all
+// subscription channels of a LongPoll including those already closed.
+type Stats struct {
+	// Delivered counts messages handed over to Get requests.
+	Delivered uint64 `json:"delivered"`
+	// Expired counts messages discarded from the queue upon expiry of their TTL.
+	Expired uint64 `json:"expired"`
+	// Conflated counts messages replaced in the queue by newer ones with the same key.
+	Conflated uint64 `json:"conflated"`
+	// Filtered counts messages to matching topics rejected by the filter of the channel.
+	Filtered uint64 `json:"filtered"`
+	// Dropped counts messages discarded from the queue when purged or when the channel was dropped.
+	Dropped uint64 `json:"dropped"`
+}
+
+func (s *Stats) add(other Stats) {
+	s.Delivered += other.Delivered
+	s.Expired += other.Expired
+	s.Conflated += other.Conflated
+	s.Filtered += other.Filtered
+	s.Dropped += other.Dropped
+}
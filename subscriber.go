@@ -0,0 +1,78 @@
+// Copyright (c) 2015-2017. Oleg Sklyar & teris.io. All rights reserved.
+// See the LICENSE file in the project root for licensing information.
+
+package longpoll
+
+import (
+	"context"
+	"time"
+)
+
+// All returns an iterator over the data received on the channel, to be used with range in Go 1.23
+// and later, or called directly with a yield function otherwise. It hides the re-poll loop making
+// Get requests with the given polltime and flattens the received batches into individual data.
+// The iteration ends when the channel is dropped or going away during a shutdown, the context is
+// done or yield returns false.
+//
+// Data remaining in the current batch when the iteration ends early is put back to the queue for
+// the next Get request. The consumer must keep up within the channel timeout as no Get requests
+// are made while yield is running.
+func (ch *Channel) All(ctx context.Context, polltime time.Duration) func(yield func(interface{}) bool) {
+	return func(yield func(interface{}) bool) {
+		// data for which yield returned false has been received by the loop body
+		ch.each(ctx, polltime, true, func(msg *Message) bool {
+			return yield(msg.Data)
+		})
+	}
+}
+
+// Subscribe streams the data received on the channel on the returned Go channel, see All. The Go
+// channel is closed when the channel is dropped or the context is done, with data not received
+// by then put back to the queue.
+func (ch *Channel) Subscribe(ctx context.Context, polltime time.Duration) <-chan interface{} {
+	res := make(chan interface{})
+	go func() {
+		defer close(res)
+		ch.each(ctx, polltime, false, func(msg *Message) bool {
+			select {
+			case res <- msg.Data:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		})
+	}()
+	return res
+}
+
+// each hands over the messages received on the channel to yield until it returns false, see All.
+// The messages of the current batch not handed over are put back to the queue, including the one
+// for which yield returned false unless taken reports that yield has received it regardless.
+func (ch *Channel) each(ctx context.Context, polltime time.Duration, taken bool, yield func(msg *Message) bool) {
+	for ctx.Err() == nil {
+		batchch, err := ch.PollContext(ctx, polltime, GetOptions{})
+		if err != nil {
+			// dropped
+			return
+		}
+		batch := <-batchch
+		for i, msg := range batch.Messages {
+			if ctx.Err() != nil {
+				// including data taken concurrently with the cancellation
+				ch.restore(&Batch{Messages: batch.Messages[i:]})
+				return
+			}
+			if !yield(msg) {
+				if taken {
+					i++
+				}
+				ch.restore(&Batch{Messages: batch.Messages[i:]})
+				return
+			}
+		}
+		if batch.GoingAway {
+			// every further Get returns empty right away until the channel is dropped
+			return
+		}
+	}
+}
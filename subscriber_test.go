@@ -0,0 +1,133 @@
+// Copyright (c) 2015-2017. Oleg Sklyar & teris.io. All rights reserved.
+// See the LICENSE file in the project root for licensing information.
+
+package longpoll_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/teris-io/longpoll"
+)
+
+func TestSubscriber_onSubscribe_flattensBatches(t *testing.T) {
+	ch := longpoll.MustNewChannel(time.Second, nil, "A")
+	defer ch.Drop()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch.PublishSync(1, "A")
+	ch.PublishSync(2, "A")
+	datach := ch.Subscribe(ctx, 100*time.Millisecond)
+	go func() {
+		time.Sleep(150 * time.Millisecond)
+		ch.PublishSync(3, "A")
+	}()
+	for expected := 1; expected <= 3; expected++ {
+		if data := <-datach; data != expected {
+			t.Errorf("expected %v, found %v", expected, data)
+		}
+	}
+}
+
+func TestSubscriber_onDrop_closes(t *testing.T) {
+	tolerance := 25 * time.Millisecond
+
+	ch := longpoll.MustNewChannel(time.Second, nil, "A")
+	datach := ch.Subscribe(context.Background(), time.Second)
+	time.Sleep(tolerance)
+	start := time.Now()
+	ch.Drop()
+	if _, ok := <-datach; ok {
+		t.Error("expected closed channel")
+	}
+	if time.Now().Sub(start) > tolerance {
+		t.Error("closed late")
+	}
+}
+
+func TestSubscriber_onCancel_closes(t *testing.T) {
+	tolerance := 25 * time.Millisecond
+
+	ch := longpoll.MustNewChannel(time.Second, nil, "A")
+	defer ch.Drop()
+	ctx, cancel := context.WithCancel(context.Background())
+	datach := ch.Subscribe(ctx, time.Second)
+	time.Sleep(tolerance)
+	start := time.Now()
+	cancel()
+	if _, ok := <-datach; ok {
+		t.Error("expected closed channel")
+	}
+	if time.Now().Sub(start) > tolerance {
+		t.Error("closed late")
+	}
+}
+
+func TestSubscriber_onAll_stopsWhenYieldReturnsFalse(t *testing.T) {
+	ch := longpoll.MustNewChannel(time.Second, nil, "A")
+	defer ch.Drop()
+	for i := 0; i < 5; i++ {
+		ch.PublishSync(i, "A")
+	}
+	var received []interface{}
+	ch.All(context.Background(), time.Second)(func(data interface{}) bool {
+		received = append(received, data)
+		return len(received) < 3
+	})
+	if len(received) != 3 || received[2] != 2 {
+		t.Errorf("unexpected data %v", received)
+	}
+	if ch.QueueSize() != 2 {
+		t.Errorf("expected the rest of the batch kept queued, found %v", ch.QueueSize())
+	}
+}
+
+func TestSubscriber_onCancelWithinBatch_keepsRestQueued(t *testing.T) {
+	ch := longpoll.MustNewChannel(time.Second, nil, "A")
+	defer ch.Drop()
+	for i := 0; i < 5; i++ {
+		ch.PublishSync(i, "A")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	datach := ch.Subscribe(ctx, time.Second)
+	if data := <-datach; data != 0 {
+		t.Errorf("expected the first data, found %v", data)
+	}
+	cancel()
+	received := 1
+	for range datach {
+		// sent concurrently with the cancellation
+		received++
+	}
+	if received+ch.QueueSize() != 5 {
+		t.Errorf("expected the rest of the batch kept queued, found %v received and %v queued", received, ch.QueueSize())
+	}
+}
+
+func TestSubscriber_onGoingAway_endsAfterRemainingData(t *testing.T) {
+	ps := longpoll.New()
+	id := ps.MustSubscribe(time.Minute, "A")
+	ch, _ := ps.Channel(id)
+	ps.PublishSync("a", "A")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	shutdown := make(chan error)
+	go func() {
+		shutdown <- ps.ShutdownContext(ctx)
+	}()
+	time.Sleep(5 * time.Millisecond)
+
+	var received []interface{}
+	for data := range ch.Subscribe(context.Background(), time.Minute) {
+		received = append(received, data)
+	}
+	if len(received) != 1 || received[0] != "a" {
+		t.Errorf("expected the remaining data, found %v", received)
+	}
+	if err := <-shutdown; err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
@@ -5,6 +5,7 @@ package longpoll
 
 import (
 	"errors"
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -20,9 +21,15 @@ import (
 // within a defined timeout (or timeout extended otherwise).
 type Timeout struct {
 	lastping  int64
+	timeout   int64
 	alive     int32
 	report    chan bool
 	onTimeout func()
+	// closed on drop to wake up the handler
+	quit     chan struct{}
+	quitOnce sync.Once
+	// closed when the handler goroutine exits
+	exited chan struct{}
 }
 
 // NewTimeout creates and starts a new timeout timer accepting an optional exit handler.
@@ -31,12 +38,15 @@ func NewTimeout(timeout time.Duration, onTimeout func()) (*Timeout, error) {
 		return nil, errors.New("positive timeout value expected")
 	}
 	tor := &Timeout{
+		timeout:   int64(timeout),
 		alive:     yes,
 		report:    make(chan bool, 1),
 		onTimeout: onTimeout,
+		quit:      make(chan struct{}),
+		exited:    make(chan struct{}),
 	}
 	tor.Ping()
-	go tor.handle(int64(timeout))
+	go tor.handle(tor.timeout)
 	return tor, nil
 }
 
@@ -63,10 +73,24 @@ func (tor *Timeout) ReportChan() chan bool {
 }
 
 // Drop drops the timeout handler and reports the exit on the reporting channel.
-// The drop will take place at most after 1/100th of the timeout and the
-// onTimeout handler will not get called.
+// The onTimeout handler will not get called.
 func (tor *Timeout) Drop() {
 	atomic.StoreInt32(&tor.alive, no)
+	tor.quitOnce.Do(func() {
+		close(tor.quit)
+	})
+}
+
+// Remaining returns the time left until the timeout unless extended by pinging, or zero if the
+// timeout handler is no longer alive.
+func (tor *Timeout) Remaining() time.Duration {
+	if !tor.IsAlive() {
+		return 0
+	}
+	if res := tor.timeout - tor.elapsed(); res > 0 {
+		return time.Duration(res)
+	}
+	return 0
 }
 
 // IsAlive verifies if the timeout handler is up and running.
@@ -75,9 +99,13 @@ func (tor *Timeout) IsAlive() bool {
 }
 
 func (tor *Timeout) handle(timeout int64) {
+	defer close(tor.exited)
 	hundredth := timeout / 100
 	for tor.elapsed() < timeout && tor.IsAlive() {
-		time.Sleep(time.Duration(hundredth))
+		select {
+		case <-time.After(time.Duration(hundredth)):
+		case <-tor.quit:
+		}
 	}
 	if tor.IsAlive() {
 		atomic.StoreInt32(&tor.alive, no)
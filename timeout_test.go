@@ -167,3 +167,20 @@ func TestTimeout_onDrop_skipsHandler_butReportsOnChannel(t *testing.T) {
 		t.Errorf("timeout or drop not reported on channel")
 	}
 }
+
+func TestTimeout_onRemaining_decreasesAndResetsOnPing(t *testing.T) {
+	tor := longpoll.MustNewTimeout(time.Second, nil)
+	defer tor.Drop()
+	time.Sleep(100 * time.Millisecond)
+	if rem := tor.Remaining(); rem > 900*time.Millisecond || rem < 800*time.Millisecond {
+		t.Errorf("unexpected remaining %v", rem)
+	}
+	tor.Ping()
+	if rem := tor.Remaining(); rem < 990*time.Millisecond {
+		t.Errorf("expected remaining reset, found %v", rem)
+	}
+	tor.Drop()
+	if rem := tor.Remaining(); rem != 0 {
+		t.Errorf("expected zero when dropped, found %v", rem)
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2015-2017. Oleg Sklyar & teris.io. All rights reserved.
+// See the LICENSE file in the project root for licensing information.
+
+package longpoll
+
+import (
+	"maps"
+	"strings"
+)
+
+// Transform returns the data to queue in place of the data of a message accepted by a
+// subscription channel, see (*Channel).SetTransform. The message must not be modified as it is
+// shared by all receiving channels. Transforms are run under the channel lock and must be fast
+// and must not call methods of the channel.
+type Transform func(msg *Message) interface{}
+
+// Project creates a transform reducing the data to the given fields, addressed by dotted paths
+// into maps, JSON objects or structs in their JSON encoding, see ParseFilter. The result is a map
+// keeping the nesting of the selected fields; missing fields are omitted. Data other than objects
+// is passed unchanged.
+func Project(fields ...string) Transform {
+	paths := make([][]string, len(fields))
+	for i, field := range fields {
+		paths[i] = strings.Split(field, ".")
+	}
+	return func(msg *Message) interface{} {
+		doc, ok := msg.document().(map[string]interface{})
+		if !ok {
+			return msg.Data
+		}
+		res := make(map[string]interface{})
+		for _, path := range paths {
+			if value := lookup(doc, path); value != nil {
+				set(res, path, value)
+			}
+		}
+		return res
+	}
+}
+
+func set(doc map[string]interface{}, path []string, value interface{}) {
+	for _, field := range path[:len(path)-1] {
+		next, ok := doc[field].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+		} else {
+			// may have been set from the document, which is shared and must not be modified
+			next = maps.Clone(next)
+		}
+		doc[field] = next
+		doc = next
+	}
+	doc[path[len(path)-1]] = value
+}
+
+// transformed creates a copy of the message carrying the given data.
+func (msg *Message) transformed(data interface{}) *Message {
+	return &Message{
+		Seq:      msg.Seq,
+		Topic:    msg.Topic,
+		Time:     msg.Time,
+		Data:     data,
+		ttl:      msg.ttl,
+		key:      msg.key,
+		priority: msg.priority,
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2015-2017. Oleg Sklyar & teris.io. All rights reserved.
+// See the LICENSE file in the project root for licensing information.
+
+package longpoll_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/teris-io/longpoll"
+)
+
+func TestTransform_onProject_keepsSelectedFields(t *testing.T) {
+	acme := order{Account: "acme", Amount: 150}
+	acme.Meta.Region = "eu"
+	project := longpoll.Project("account", "meta.region", "missing")
+	for _, data := range []interface{}{
+		acme,
+		map[string]interface{}{"account": "acme", "amount": 150, "meta": map[string]interface{}{"region": "eu"}},
+		json.RawMessage(`{"account": "acme", "amount": 150, "meta": {"region": "eu", "zone": 1}}`),
+	} {
+		expected := map[string]interface{}{"account": "acme", "meta": map[string]interface{}{"region": "eu"}}
+		if res := project(&longpoll.Message{Data: data}); !reflect.DeepEqual(res, expected) {
+			t.Errorf("unexpected projection of %v: %v", data, res)
+		}
+	}
+	if res := project(&longpoll.Message{Data: "plain"}); res != "plain" {
+		t.Errorf("expected non-objects unchanged, found %v", res)
+	}
+}
+
+func TestTransform_onProjectNestedConcurrently_safe(t *testing.T) {
+	msg := &longpoll.Message{Data: json.RawMessage(`{"meta": {"region": "eu", "zone": 1}}`)}
+	project := longpoll.Project("meta", "meta.region")
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			project(msg)
+		}()
+	}
+	wg.Wait()
+}